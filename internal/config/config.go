@@ -1,6 +1,7 @@
 package config
 
 import (
+	"crypto/rand"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -19,18 +20,69 @@ type RabbitMQ struct {
 }
 
 type Server struct {
-	Address     string `json:"address"`
-	Port        int    `json:"port"`
-	EnableHTTPS bool   `json:"enable_https"`
-	CertPath    string `json:"cert_path"`
-	KeyPath     string `json:"key_path"`
+	Address       string `json:"address"`
+	Port          int    `json:"port"`
+	EnableHTTPS   bool   `json:"enable_https"`
+	CertPath      string `json:"cert_path"`
+	KeyPath       string `json:"key_path"`
+	MaxSourceSize int64  `json:"max_source_size"` // 源代码大小上限 (字节)
+	DrainTimeout  int    `json:"drain_timeout"`   // 关闭时等待进行中任务完成的最长时间 (秒)，超时的任务重新入队
+	SourceTTL     int    `json:"source_ttl"`      // 未被评测的上传代码副本的保留时间 (分钟)，默认 60
+}
+
+type AuthToken struct {
+	Token  string   `json:"token"`
+	Scopes []string `json:"scopes"` // 可访问的范围: judge, run, rejudge, settings, * 表示全部
+}
+
+type Auth struct {
+	Mode         string      `json:"mode"`           // 认证方式: hmac, token, mtls, none
+	Secret       string      `json:"secret"`         // HMAC 共享密钥
+	MaxSkew      int         `json:"max_skew"`       // HMAC 签名允许的时间偏差 (秒)
+	Tokens       []AuthToken `json:"tokens"`         // Bearer Token 及其范围
+	ClientCAPath string      `json:"client_ca_path"` // mTLS 客户端CA证书
+}
+
+// LanguagePool 单个语言沙盒子池的大小
+type LanguagePool struct {
+	MinSize int `json:"min_size"` // 最小数量，默认 1
+	MaxSize int `json:"max_size"` // 最大数量，不大于最小数量时不自动扩缩容
 }
 
 type Sandbox struct {
-	Memory        int64   `json:"memory"`         // 内存限制 (字节)
-	NanoCPUs      float64 `json:"nano_cpus"`      // CPU限制 (核心数)
-	CPUShares     int64   `json:"cpu_shares"`     // CPU权重
-	MaxConcurrent int     `json:"max_concurrent"` // 最大并发数
+	Memory           int64                   `json:"memory"`             // 内存限制 (字节)
+	NanoCPUs         float64                 `json:"nano_cpus"`          // CPU限制 (核心数)
+	CPUShares        int64                   `json:"cpu_shares"`         // CPU权重
+	MaxConcurrent    int                     `json:"max_concurrent"`     // 最大并发数，未配置 min_size 时作为固定池大小
+	MinSize          int                     `json:"min_size"`           // 沙盒池最小数量，0 表示使用 max_concurrent
+	MaxSize          int                     `json:"max_size"`           // 沙盒池最大数量，不大于最小数量时不自动扩缩容
+	ScaleInterval    int                     `json:"scale_interval"`     // 自动扩缩容检查间隔 (秒)，默认 10
+	ScaleCooldown    int                     `json:"scale_cooldown"`     // 负载下降后等待多久才缩容 (秒)，默认 120
+	MaxLoad          float64                 `json:"max_load"`           // 扩容时允许的每核 1 分钟平均负载上限，0 表示不检查
+	MinFreeMemory    int64                   `json:"min_free_memory"`    // 扩容时主机需保留的可用内存 (字节)，0 表示不检查
+	Pools            map[string]LanguagePool `json:"pools"`              // 按语言划分的子池，每种语言使用只含其工具链的镜像，留空时所有语言共用一个池
+	NetworkMode      string                  `json:"network_mode"`       // 容器网络模式，默认 none 禁用网络
+	User             string                  `json:"user"`               // 编译与运行代码的用户 (UID:GID)，默认 65534:65534
+	ReadonlyRoot     bool                    `json:"readonly_root"`      // 只读根文件系统
+	WorkDirSize      string                  `json:"work_dir_size"`      // 工作目录 tmpfs 大小，如 512m
+	NoNewPrivs       bool                    `json:"no_new_privs"`       // 禁止进程获取新权限
+	PidsLimit        int64                   `json:"pids_limit"`         // 每个沙盒的进程数上限
+	Seccomp          string                  `json:"seccomp"`            // seccomp 配置文件路径，留空使用内置配置，unconfined 表示禁用
+	Runtime          string                  `json:"runtime"`            // 容器 OCI 运行时，如 runsc、kata，留空使用 Docker 默认运行时
+	Dockerfile       string                  `json:"dockerfile"`         // 沙盒镜像的 Dockerfile 路径，留空使用内置的 Dockerfile
+	Registry         string                  `json:"registry"`           // 拉取预构建镜像的仓库地址，如 127.0.0.1:5000，留空在本地构建
+	HealthCheck      int                     `json:"health_check"`       // 空闲沙盒健康检查间隔 (秒)，默认 30
+	AcquireTimeout   int                     `json:"acquire_timeout"`    // 获取沙盒的最长等待时间 (秒)，超时后任务重新入队，默认 60
+	ArtifactCache    int64                   `json:"artifact_cache"`     // 编译产物缓存大小上限 (字节)，0 表示不缓存
+	ArtifactCacheDir string                  `json:"artifact_cache_dir"` // 编译产物缓存目录
+	MaxUses          int                     `json:"max_uses"`           // 沙盒完成多少次任务后被替换，0 表示不限制
+	MaxAge           int                     `json:"max_age"`            // 沙盒最长存活时间 (分钟)，0 表示不限制
+	MaxParallelCases int                     `json:"max_parallel_cases"` // 单次评测同时运行的测试点数量上限，题目设置与请求均不能超过，不大于1时顺序运行
+	Backend          string                  `json:"backend"`            // 沙盒后端: docker、local 或 jail，默认 docker
+	LocalNS          bool                    `json:"local_ns"`           // local 后端是否为每个沙盒创建独立的用户、网络、IPC、UTS 命名空间
+	JailPath         string                  `json:"jail_path"`          // jail 后端使用的 bubblewrap 路径，默认从 PATH 查找 bwrap
+	CgroupRoot       string                  `json:"cgroup_root"`        // jail 后端创建运行 cgroup 的父 cgroup，需已委派给 JudgeCore
+	JailBinds        []string                `json:"jail_binds"`         // jail 中额外以只读方式挂载的宿主机目录
 }
 
 type Database struct {
@@ -48,6 +100,7 @@ type AppConfig struct {
 	Consul   Consul   `json:"consul"`
 	RabbitMQ RabbitMQ `json:"rabbitmq"`
 	Server   Server   `json:"server"`
+	Auth     Auth     `json:"auth"`
 	Sandbox  Sandbox  `json:"sandbox"`
 	Database Database `json:"database"`
 }
@@ -72,7 +125,11 @@ func LoadConfig(currentDir string) (*AppConfig, error) {
 	}
 	defer configFile.Close()
 
-	var config AppConfig
+	// 在默认配置上解码，旧配置文件中缺少的新配置项取默认值而不是零值
+	// 自动扩缩容、编译产物缓存与沙盒回收需要在配置文件中显式开启，缺少时保持关闭，池大小沿用 max_concurrent
+	config := defaultConfig()
+	config.Sandbox.MinSize, config.Sandbox.MaxSize = 0, 0
+	config.Sandbox.ArtifactCache, config.Sandbox.MaxUses, config.Sandbox.MaxAge = 0, 0, 0
 	if err := json.NewDecoder(configFile).Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %v", err)
 	}
@@ -80,9 +137,23 @@ func LoadConfig(currentDir string) (*AppConfig, error) {
 	return &config, nil
 }
 
-// createDefaultConfig 创建默认配置文件
+// createDefaultConfig 创建默认配置文件，并生成随机的 HMAC 共享密钥
 func createDefaultConfig(filePath string) error {
-	defaultConfig := AppConfig{
+	defaultConfig := defaultConfig()
+	defaultConfig.Auth.Secret = rand.Text()
+
+	// 将配置写入文件
+	configData, err := json.MarshalIndent(defaultConfig, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, configData, 0644)
+}
+
+// defaultConfig 获取默认配置
+func defaultConfig() AppConfig {
+	return AppConfig{
 		Consul: struct {
 			Address     string `json:"address"`
 			ServiceName string `json:"service_name"`
@@ -98,28 +169,105 @@ func createDefaultConfig(filePath string) error {
 			Address: "amqp://USER:PASSWORD@IP:PORT/",
 		},
 		Server: struct {
-			Address     string `json:"address"`
-			Port        int    `json:"port"`
-			EnableHTTPS bool   `json:"enable_https"`
-			CertPath    string `json:"cert_path"`
-			KeyPath     string `json:"key_path"`
+			Address       string `json:"address"`
+			Port          int    `json:"port"`
+			EnableHTTPS   bool   `json:"enable_https"`
+			CertPath      string `json:"cert_path"`
+			KeyPath       string `json:"key_path"`
+			MaxSourceSize int64  `json:"max_source_size"`
+			DrainTimeout  int    `json:"drain_timeout"`
+			SourceTTL     int    `json:"source_ttl"`
 		}{
-			Address:     "127.0.0.1",
-			Port:        37885,
-			EnableHTTPS: false,
-			CertPath:    "./certificate/fullchain.pem",
-			KeyPath:     "./certificate/privkey.key",
+			Address:       "127.0.0.1",
+			Port:          37885,
+			EnableHTTPS:   false,
+			CertPath:      "./certificate/fullchain.pem",
+			KeyPath:       "./certificate/privkey.key",
+			MaxSourceSize: 64 * 1024,
+			DrainTimeout:  60,
+			SourceTTL:     60,
+		},
+		Auth: struct {
+			Mode         string      `json:"mode"`
+			Secret       string      `json:"secret"`
+			MaxSkew      int         `json:"max_skew"`
+			Tokens       []AuthToken `json:"tokens"`
+			ClientCAPath string      `json:"client_ca_path"`
+		}{
+			Mode:         "hmac",
+			Secret:       "",
+			MaxSkew:      300,
+			Tokens:       []AuthToken{},
+			ClientCAPath: "./certificate/ca.pem",
 		},
 		Sandbox: struct {
-			Memory        int64   `json:"memory"`
-			NanoCPUs      float64 `json:"nano_cpus"`
-			CPUShares     int64   `json:"cpu_shares"`
-			MaxConcurrent int     `json:"max_concurrent"`
+			Memory           int64                   `json:"memory"`
+			NanoCPUs         float64                 `json:"nano_cpus"`
+			CPUShares        int64                   `json:"cpu_shares"`
+			MaxConcurrent    int                     `json:"max_concurrent"`
+			MinSize          int                     `json:"min_size"`
+			MaxSize          int                     `json:"max_size"`
+			ScaleInterval    int                     `json:"scale_interval"`
+			ScaleCooldown    int                     `json:"scale_cooldown"`
+			MaxLoad          float64                 `json:"max_load"`
+			MinFreeMemory    int64                   `json:"min_free_memory"`
+			Pools            map[string]LanguagePool `json:"pools"`
+			NetworkMode      string                  `json:"network_mode"`
+			User             string                  `json:"user"`
+			ReadonlyRoot     bool                    `json:"readonly_root"`
+			WorkDirSize      string                  `json:"work_dir_size"`
+			NoNewPrivs       bool                    `json:"no_new_privs"`
+			PidsLimit        int64                   `json:"pids_limit"`
+			Seccomp          string                  `json:"seccomp"`
+			Runtime          string                  `json:"runtime"`
+			Dockerfile       string                  `json:"dockerfile"`
+			Registry         string                  `json:"registry"`
+			HealthCheck      int                     `json:"health_check"`
+			AcquireTimeout   int                     `json:"acquire_timeout"`
+			ArtifactCache    int64                   `json:"artifact_cache"`
+			ArtifactCacheDir string                  `json:"artifact_cache_dir"`
+			MaxUses          int                     `json:"max_uses"`
+			MaxAge           int                     `json:"max_age"`
+			MaxParallelCases int                     `json:"max_parallel_cases"`
+			Backend          string                  `json:"backend"`
+			LocalNS          bool                    `json:"local_ns"`
+			JailPath         string                  `json:"jail_path"`
+			CgroupRoot       string                  `json:"cgroup_root"`
+			JailBinds        []string                `json:"jail_binds"`
 		}{
-			Memory:        2 * 1024 * 1024 * 1024,
-			NanoCPUs:      0.5,
-			CPUShares:     1024,
-			MaxConcurrent: 5,
+			Memory:           2 * 1024 * 1024 * 1024,
+			NanoCPUs:         0.5,
+			CPUShares:        1024,
+			MaxConcurrent:    5,
+			MinSize:          2,
+			MaxSize:          10,
+			ScaleInterval:    10,
+			ScaleCooldown:    120,
+			MaxLoad:          0.9,
+			MinFreeMemory:    1024 * 1024 * 1024,
+			Pools:            map[string]LanguagePool{},
+			NetworkMode:      "none",
+			User:             "65534:65534",
+			ReadonlyRoot:     true,
+			WorkDirSize:      "512m",
+			NoNewPrivs:       true,
+			PidsLimit:        128,
+			Seccomp:          "",
+			Runtime:          "",
+			Dockerfile:       "",
+			Registry:         "",
+			HealthCheck:      30,
+			AcquireTimeout:   60,
+			ArtifactCache:    512 * 1024 * 1024,
+			ArtifactCacheDir: "./cache/artifacts",
+			MaxUses:          200,
+			MaxAge:           60,
+			MaxParallelCases: 4,
+			Backend:          "docker",
+			LocalNS:          true,
+			JailPath:         "bwrap",
+			CgroupRoot:       "/sys/fs/cgroup/judgecore",
+			JailBinds:        []string{},
 		},
 		Database: struct {
 			Address      string `json:"address"`
@@ -139,14 +287,6 @@ func createDefaultConfig(filePath string) error {
 			MaxLifeTime:  32,
 		},
 	}
-
-	// 将配置写入文件
-	configData, err := json.MarshalIndent(defaultConfig, "", "  ")
-	if err != nil {
-		return err
-	}
-
-	return os.WriteFile(filePath, configData, 0644)
 }
 
 // SaveConfig 保存配置到文件
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConfigKeepsDefaultsForMissingKeys(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"sandbox": {"memory": 1024, "pids_limit": 64}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Sandbox.Memory != 1024 || cfg.Sandbox.PidsLimit != 64 {
+		t.Errorf("configured values were not loaded: %+v", cfg.Sandbox)
+	}
+	// 旧配置文件中没有的安全选项保持开启
+	if !cfg.Sandbox.ReadonlyRoot || !cfg.Sandbox.NoNewPrivs {
+		t.Error("hardening defaults were lost")
+	}
+	if cfg.Auth.Secret != "" {
+		t.Error("missing secret must not be generated on load")
+	}
+}
+
+func TestLoadConfigLegacyMaxConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	data := `{"sandbox": {"max_concurrent": 3}}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := LoadConfig(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sandbox := cfg.Sandbox
+	if sandbox.MaxConcurrent != 3 {
+		t.Errorf("max_concurrent %d, want 3", sandbox.MaxConcurrent)
+	}
+	// 未开启的功能保持关闭，共享池大小由 max_concurrent 决定
+	if sandbox.MinSize != 0 || sandbox.MaxSize != 0 || sandbox.ArtifactCache != 0 || sandbox.MaxUses != 0 || sandbox.MaxAge != 0 {
+		t.Errorf("opt-in sandbox features were enabled: %+v", sandbox)
+	}
+}
+
+func TestLoadConfigCreatesDefaults(t *testing.T) {
+	cfg, err := LoadConfig(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 新生成的配置文件写入了推荐值
+	if cfg.Sandbox.MinSize != 2 || cfg.Sandbox.MaxSize != 10 || cfg.Sandbox.ArtifactCache == 0 {
+		t.Errorf("default config was not written: %+v", cfg.Sandbox)
+	}
+	if cfg.Auth.Secret == "" {
+		t.Error("default config has no secret")
+	}
+}
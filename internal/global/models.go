@@ -1,16 +1,42 @@
 package global
 
+import "time"
+
 // 测试样例请求体
 type TestCaseRequest struct {
 	InputData  string `json:"input"`
 	OutputData string `json:"output"`
 }
 
+// 判题队列JSON任务消息，兼容旧的 "uid_pid.ext" 纯文本格式
+type TaskMessage struct {
+	Type         string `json:"type"`
+	RunID        string `json:"run_id"`
+	UserID       int    `json:"user_id"`
+	ProblemID    int    `json:"problem_id"`
+	Filename     string `json:"filename"`       // 评测任务的代码文件名
+	Language     string `json:"language"`       // 运行任务的语言
+	Code         string `json:"code"`           // 运行任务的源代码
+	Input        string `json:"input"`          // 运行任务的自定义输入
+	CasePolicy   string `json:"case_policy"`    // 评测任务的测试点运行策略，为空时使用评测设置
+	SubmissionID int    `json:"submission_id"`  // 提交ID，评测任务未指定时按用户与题目更新提交记录
+	RejudgeJobID string `json:"rejudge_job_id"` // 重判任务所属的重判任务ID
+}
+
+// 自定义输入运行结果信息结构体
+type RunResultMessage struct {
+	RunID     string     `json:"run_id"`
+	UserID    int        `json:"user_id"`
+	ProblemID int        `json:"problem_id"`
+	Result    *RunResult `json:"result"`
+}
+
 // 判题结果信息结构体
 type JudgeResultMessage struct {
-	UserID    int    `json:"user_id"`
-	ProblemID int    `json:"problem_id"`
-	Status    string `json:"status"`
+	UserID    int          `json:"user_id"`
+	ProblemID int          `json:"problem_id"`
+	Status    string       `json:"status"`
+	Cases     []CaseResult `json:"cases,omitempty"` // 已运行测试点的结果，run_all 策略下包含全部测试点
 }
 
 // 题目表: pid, difficulty, title, content, time_limit, memory_limit, input, output, contestid, is_visible
@@ -26,3 +52,108 @@ type Problem struct {
 	ContestID   int    `gorm:"comment:所属竞赛ID;not null"`
 	IsVisible   bool   `gorm:"comment:是否可见;not null"`
 }
+
+// 提交记录表: sid, pid, uid, username, result, time, language, code
+type SubmitRecord struct {
+	Sid      int       `gorm:"comment:提交ID;primaryKey;autoIncrement"`
+	Pid      int       `gorm:"comment:题目ID;not null"`
+	Uid      int       `gorm:"comment:用户ID;not null"`
+	Username string    `gorm:"comment:用户名;not null"`
+	Result   string    `gorm:"comment:结果"`
+	Time     time.Time `gorm:"comment:提交时间;not null"`
+	Language string    `gorm:"comment:语言;not null"`
+	Code     string    `gorm:"comment:代码;not null"`
+}
+
+// 重判任务表: id, scope, target_id, total, created_at
+// 任务进度由重判记录表统计
+type RejudgeJob struct {
+	ID        string    `gorm:"comment:重判任务ID;primaryKey;size:64"`
+	Scope     string    `gorm:"comment:重判范围;size:32;not null"`
+	TargetID  int       `gorm:"comment:重判对象ID;not null"`
+	Total     int       `gorm:"comment:提交记录数量;not null"`
+	CreatedAt time.Time `gorm:"comment:创建时间;index;not null"`
+}
+
+// 重判记录表: id, job_id, sid, pid, uid, old_result, new_result, created_at
+// 同一重判任务中每条提交记录只有一条重判记录，重复投递的任务不会重复计数
+type RejudgeRecord struct {
+	ID        int       `gorm:"comment:记录ID;primaryKey;autoIncrement"`
+	JobID     string    `gorm:"comment:重判任务ID;size:64;uniqueIndex:idx_rejudge_job_sid;not null"`
+	Sid       int       `gorm:"comment:提交ID;uniqueIndex:idx_rejudge_job_sid;index;not null"`
+	Pid       int       `gorm:"comment:题目ID;not null"`
+	Uid       int       `gorm:"comment:用户ID;not null"`
+	OldResult string    `gorm:"comment:原结果"`
+	NewResult string    `gorm:"comment:新结果，重判失败时为空"`
+	CreatedAt time.Time `gorm:"comment:重判时间;not null"`
+}
+
+// 重判任务进度，由重判记录统计
+type RejudgeProgress struct {
+	Done     int
+	Changed  int
+	Failed   int
+	LastDone *time.Time
+}
+
+// 评测设置表: pid, parallel_cases, case_policy
+// 由 JudgeCore 维护，未设置的题目使用默认值
+type JudgeSetting struct {
+	Pid           int    `gorm:"comment:题目ID;primaryKey;autoIncrement:false" json:"pid"`
+	ParallelCases int    `gorm:"comment:同时运行的测试点数量，不大于1时顺序运行;not null;default:0" json:"parallel_cases"`
+	CasePolicy    string `gorm:"comment:测试点运行策略，为空时使用竞赛的设置;not null;default:''" json:"case_policy"`
+}
+
+// 竞赛评测设置表: contest_id, case_policy
+// 竞赛内的题目未单独设置时使用
+type ContestJudgeSetting struct {
+	ContestID  int    `gorm:"comment:竞赛ID;primaryKey;autoIncrement:false" json:"contest_id"`
+	CasePolicy string `gorm:"comment:测试点运行策略，为空时使用默认策略;not null;default:''" json:"case_policy"`
+}
+
+// 同步评测请求体
+type JudgeRequest struct {
+	Language      string             `json:"language" binding:"required"`
+	Code          string             `json:"code" binding:"required"`
+	ProblemID     int                `json:"problem_id"`
+	TestCases     []*TestCaseRequest `json:"test_cases"`
+	TimeLimit     int                `json:"time_limit"`     // 时间限制 (秒)，仅在内联测试样例时使用
+	MemoryLimit   int                `json:"memory_limit"`   // 内存限制 (MB)，仅在内联测试样例时使用
+	ParallelCases int                `json:"parallel_cases"` // 同时运行的测试点数量，未指定时使用题目的评测设置
+	CasePolicy    string             `json:"case_policy"`    // 测试点运行策略，未指定时使用题目或竞赛的评测设置
+}
+
+// 单个测试样例的评测结果
+type CaseResult struct {
+	Index    int    `json:"index"`
+	Status   string `json:"status"`
+	TimeMs   int64  `json:"time_ms"`
+	MemoryKB int64  `json:"memory_kb"`
+}
+
+// 评测结果
+type JudgeResult struct {
+	Status  string       `json:"status"`
+	Message string       `json:"message,omitempty"` // 编译错误等附加信息
+	Cases   []CaseResult `json:"cases"`
+}
+
+// 自定义输入运行请求体
+type RunRequest struct {
+	Language    string `json:"language" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	Input       string `json:"input"`
+	ProblemID   int    `json:"problem_id"`
+	TimeLimit   int    `json:"time_limit"`   // 时间限制 (秒)，未指定题目时使用
+	MemoryLimit int    `json:"memory_limit"` // 内存限制 (MB)，未指定题目时使用
+}
+
+// 自定义输入运行结果
+type RunResult struct {
+	Status   string `json:"status"`
+	Message  string `json:"message,omitempty"` // 编译错误等附加信息
+	Stdout   string `json:"stdout"`
+	Stderr   string `json:"stderr"`
+	TimeMs   int64  `json:"time_ms"`
+	MemoryKB int64  `json:"memory_kb"`
+}
@@ -18,4 +18,26 @@ const (
 	RuntimeError string = "Error"
 	// 系统错误
 	SystemError string = "Error"
+	// 调用了被禁止的系统调用
+	RestrictedFunction string = "Restricted Function"
+	// 运行完成 (自定义输入运行)
+	Finished string = "Finished"
+)
+
+// 判题队列任务类型
+const (
+	// 评测任务
+	TaskTypeJudge string = "judge"
+	// 自定义输入运行任务
+	TaskTypeRun string = "run"
+	// 重判任务，评测提交记录中保存的代码并按提交ID更新结果
+	TaskTypeRejudge string = "rejudge"
+)
+
+// 测试点运行策略
+const (
+	// 在首个未通过的测试点停止 (默认)
+	CasePolicyStopOnFailure string = "stop_on_failure"
+	// 运行全部测试点并报告每个测试点的结果
+	CasePolicyRunAll string = "run_all"
 )
@@ -0,0 +1,152 @@
+package judge
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultScaleInterval 未配置时的自动扩缩容检查间隔
+	defaultScaleInterval = 10 * time.Second
+	// defaultScaleCooldown 未配置时负载下降到缩容之间的等待时间
+	defaultScaleCooldown = 2 * time.Minute
+)
+
+// Autoscale 定期根据队列积压与主机资源余量调整各语言沙盒池大小，直到池关闭
+// queueDepth 返回队列中等待处理的任务数，仅在只有一个子池时使用，所有子池大小都固定时直接返回
+func (p *JudgePool) Autoscale(queueDepth func() (int, error)) {
+	scalable := false
+	for _, sub := range p.pools {
+		scalable = scalable || sub.maxSize > sub.minSize
+	}
+	if !scalable {
+		return
+	}
+
+	interval := defaultScaleInterval
+	if p.sandboxConfig.ScaleInterval > 0 {
+		interval = time.Duration(p.sandboxConfig.ScaleInterval) * time.Second
+	}
+	cooldown := defaultScaleCooldown
+	if p.sandboxConfig.ScaleCooldown > 0 {
+		cooldown = time.Duration(p.sandboxConfig.ScaleCooldown) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+		}
+
+		// 队列不区分语言，只有一个子池时积压才能完全归属于它
+		queued := 0
+		if len(p.pools) == 1 {
+			depth, err := queueDepth()
+			if err != nil {
+				log.Printf("[FeasOJ] Failed to inspect task queue for autoscaling: %v", err)
+				continue
+			}
+			queued = depth
+		}
+		for _, sub := range p.pools {
+			sub.scale(queued, cooldown)
+		}
+	}
+}
+
+// scale 根据积压调整子池大小，积压为正在等待该子池沙盒的任务数加上归属于该子池的队列积压
+// 多个子池时任务在 worker 取出后才知道语言，积压只能通过各子池自己的等待者体现
+func (p *subPool) scale(queued int, cooldown time.Duration) {
+	if p.maxSize <= p.minSize {
+		return
+	}
+
+	p.mutex.Lock()
+	idle := len(p.pool)
+	busy := p.size - idle
+	target := p.target
+	p.mutex.Unlock()
+
+	backlog := int(p.wait.snapshot().Waiting)
+	if idle == 0 {
+		backlog += queued
+	}
+	desired := scaleTarget(busy, backlog, p.minSize, p.maxSize)
+	switch {
+	case desired > target:
+		p.lastBusy = time.Now()
+		if err := hostHeadroom(p.sandboxConfig.MaxLoad, p.sandboxConfig.MinFreeMemory+p.sandboxConfig.Memory); err != nil {
+			log.Printf("[FeasOJ] Not scaling %s sandbox pool up to %d: %v", p.name(), desired, err)
+			return
+		}
+		p.resize(desired)
+	case desired < target:
+		// 负载持续低于目标数量一段时间后才缩容，避免频繁创建销毁沙盒
+		if time.Since(p.lastBusy) >= cooldown {
+			p.resize(desired)
+		}
+	default:
+		p.lastBusy = time.Now()
+	}
+}
+
+// scaleTarget 计算所需的沙盒数量：正在使用的加上排队等待的，限制在上下限之间
+func scaleTarget(busy, backlog, minSize, maxSize int) int {
+	return min(max(busy+backlog, minSize), maxSize)
+}
+
+// hostHeadroom 检查主机是否还有余量创建新沙盒，无法读取主机信息 (非 Linux) 时不限制
+// maxLoad 为每核 1 分钟平均负载上限，minFree 为扩容后仍需保留的可用内存 (字节)，0 表示不检查
+func hostHeadroom(maxLoad float64, minFree int64) error {
+	if maxLoad > 0 {
+		if data, err := os.ReadFile("/proc/loadavg"); err == nil {
+			fields := strings.Fields(string(data))
+			if len(fields) > 0 {
+				if load, err := strconv.ParseFloat(fields[0], 64); err == nil {
+					if perCPU := load / float64(runtime.NumCPU()); perCPU > maxLoad {
+						return fmt.Errorf("load %.2f per CPU exceeds %.2f", perCPU, maxLoad)
+					}
+				}
+			}
+		}
+	}
+
+	if minFree > 0 {
+		if available, err := memAvailable(); err == nil && available < minFree {
+			return fmt.Errorf("only %d MB memory available, need %d MB", available>>20, minFree>>20)
+		}
+	}
+	return nil
+}
+
+// memAvailable 从 /proc/meminfo 读取可用内存 (字节)
+func memAvailable() (int64, error) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		value, found := strings.CutPrefix(scanner.Text(), "MemAvailable:")
+		if !found {
+			continue
+		}
+		kb, err := strconv.ParseInt(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return kb * 1024, nil
+	}
+	return 0, fmt.Errorf("MemAvailable not found in /proc/meminfo")
+}
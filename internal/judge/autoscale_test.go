@@ -0,0 +1,78 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"testing"
+	"time"
+)
+
+func TestScaleTarget(t *testing.T) {
+	cases := []struct{ busy, backlog, want int }{
+		{0, 0, 2},
+		{2, 3, 5},
+		{4, 20, 8},
+	}
+	for _, c := range cases {
+		if got := scaleTarget(c.busy, c.backlog, 2, 8); got != c.want {
+			t.Error(c.busy, c.backlog, got)
+		}
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	pool, err := NewJudgePool(config.Sandbox{Backend: BackendLocal, MinSize: 1, MaxSize: 3}, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Initialize()
+	defer pool.Shutdown()
+	sub := pool.pools[""]
+
+	resized := make(chan int, 2)
+	pool.OnResize(func(n int) { resized <- n })
+
+	sub.resize(5)
+	if n := <-resized; n != 3 {
+		t.Errorf("resized to %d, want 3", n)
+	}
+	sandboxes := []Sandbox{acquire(t, pool, ".py"), acquire(t, pool, ".py"), acquire(t, pool, ".py")}
+
+	// 缩容时正在使用的沙盒在归还时销毁
+	sub.resize(1)
+	<-resized
+	for _, sb := range sandboxes {
+		pool.ReleaseContainer(sb)
+	}
+	if len(sub.pool) != 1 {
+		t.Errorf("pool has %d idle sandboxes, want 1", len(sub.pool))
+	}
+}
+
+func TestSubPoolScaleCountsWaiters(t *testing.T) {
+	pool, err := NewJudgePool(config.Sandbox{Backend: BackendLocal, MinSize: 1, MaxSize: 4}, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Initialize()
+	defer pool.Shutdown()
+	sub := pool.pools[""]
+
+	// 有空闲沙盒时不计入队列积压
+	sub.scale(10, time.Minute)
+	if sub.targetSize() != 1 {
+		t.Errorf("target %d, want 1", sub.targetSize())
+	}
+
+	sb := acquire(t, pool, ".py")
+	defer pool.ReleaseContainer(sb)
+	sub.wait.begin()
+	sub.wait.begin()
+	defer sub.wait.end(time.Now(), false)
+	defer sub.wait.end(time.Now(), false)
+
+	// 一个正在使用加上两个等待者
+	sub.scale(0, time.Minute)
+	if sub.targetSize() != 3 {
+		t.Errorf("target %d, want 3", sub.targetSize())
+	}
+}
@@ -0,0 +1,257 @@
+package judge
+
+import (
+	"archive/tar"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ArtifactCache 以内容寻址的编译产物缓存，存放在宿主机目录中，总大小超出上限时淘汰最久未使用的产物
+type ArtifactCache struct {
+	dir     string
+	maxSize int64
+	mutex   sync.Mutex
+	lru     *list.List               // 最近使用的在前
+	entries map[string]*list.Element // 缓存键 -> lru 中的 *artifactEntry
+	size    int64
+}
+
+// artifactEntry 单个缓存的编译产物
+type artifactEntry struct {
+	key  string
+	size int64
+}
+
+// NewArtifactCache 创建编译产物缓存，并按修改时间恢复目录中已有的产物
+func NewArtifactCache(dir string, maxSize int64) (*ArtifactCache, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	c := &ArtifactCache{
+		dir:     dir,
+		maxSize: maxSize,
+		lru:     list.New(),
+		entries: make(map[string]*list.Element),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var infos []fs.FileInfo
+	for _, file := range files {
+		info, err := file.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		// 清理上次运行中断时留下的临时文件
+		if strings.HasPrefix(info.Name(), ".") {
+			os.Remove(filepath.Join(dir, info.Name()))
+			continue
+		}
+		infos = append(infos, info)
+	}
+	slices.SortFunc(infos, func(a, b fs.FileInfo) int {
+		return b.ModTime().Compare(a.ModTime())
+	})
+	for _, info := range infos {
+		c.entries[info.Name()] = c.lru.PushBack(&artifactEntry{key: info.Name(), size: info.Size()})
+		c.size += info.Size()
+	}
+
+	c.mutex.Lock()
+	c.evictLocked()
+	c.mutex.Unlock()
+	log.Printf("[FeasOJ] Loaded %d cached compile artifacts (%d bytes)", c.lru.Len(), c.size)
+	return c, nil
+}
+
+// compileCache 子池使用的编译产物缓存，env 区分不同沙盒环境 (如镜像) 编译的产物
+type compileCache struct {
+	artifacts *ArtifactCache
+	env       string
+}
+
+// artifactKey 根据沙盒环境、语言、编译命令与源代码生成缓存键
+func artifactKey(env, ext string, code []byte) string {
+	hash := sha256.New()
+	for _, part := range []string{env, ext, compileScript(ext, "source"+ext, "/task")} {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(code)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Get 获取缓存的编译产物，命中时将其标记为最近使用
+func (c *ArtifactCache) Get(key string) ([]byte, bool) {
+	c.mutex.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	path := filepath.Join(c.dir, key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// 读取期间被淘汰
+		return nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	return data, true
+}
+
+// Put 保存编译产物，超过缓存上限的产物不被缓存
+func (c *ArtifactCache) Put(key string, data []byte) {
+	size := int64(len(data))
+	if size > c.maxSize {
+		return
+	}
+
+	// 先写入临时文件再重命名，避免读到不完整的产物
+	tmp, err := os.CreateTemp(c.dir, ".artifact-")
+	if err != nil {
+		log.Printf("[FeasOJ] Failed to cache compile artifact: %v", err)
+		return
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("[FeasOJ] Failed to cache compile artifact: %v", err)
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, key)); err != nil {
+		os.Remove(tmp.Name())
+		log.Printf("[FeasOJ] Failed to cache compile artifact: %v", err)
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*artifactEntry).size
+		c.lru.Remove(elem)
+	}
+	c.entries[key] = c.lru.PushFront(&artifactEntry{key: key, size: size})
+	c.size += size
+	c.evictLocked()
+}
+
+// evictLocked 淘汰最久未使用的产物直到总大小不超过上限，调用方需持有 mutex
+func (c *ArtifactCache) evictLocked() {
+	for c.size > c.maxSize {
+		elem := c.lru.Back()
+		entry := elem.Value.(*artifactEntry)
+		c.lru.Remove(elem)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		os.Remove(filepath.Join(c.dir, entry.key))
+	}
+}
+
+// archiveDir 将目录中的普通文件与子目录打包为 tar 归档，忽略符号链接等特殊文件
+func archiveDir(dir string) ([]byte, error) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || path == dir {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		file, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// extractArchive 将 archiveDir 生成的归档解包到目录，拒绝指向目录外的路径
+func extractArchive(dir string, data []byte) error {
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !filepath.IsLocal(header.Name) {
+			return fmt.Errorf("invalid path in artifact: %s", header.Name)
+		}
+
+		path := filepath.Join(dir, header.Name)
+		mode := header.FileInfo().Mode().Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, mode|0700); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(file, tr)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
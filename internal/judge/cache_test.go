@@ -0,0 +1,160 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"JudgeCore/internal/global"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestArtifactCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := NewArtifactCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache.Put("a", []byte("aaaa"))
+	cache.Put("b", []byte("bbbb"))
+	cache.Get("a")
+	cache.Put("c", []byte("cccc"))
+	if _, ok := cache.Get("b"); ok {
+		t.Error("least recently used artifact was not evicted")
+	}
+	if data, ok := cache.Get("a"); !ok || string(data) != "aaaa" {
+		t.Errorf("got %q, %v for a recently used artifact", data, ok)
+	}
+
+	// 重启后恢复已有的产物
+	cache, err = NewArtifactCache(dir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get("c"); !ok {
+		t.Error("artifact was not restored from disk")
+	}
+}
+
+// countingSandbox 记录编译与解包次数的沙盒
+type countingSandbox struct {
+	Sandbox
+	compiles, loads int
+}
+
+func (s *countingSandbox) ID() string {
+	return "counting"
+}
+
+func (s *countingSandbox) Prepare(ctx context.Context, filename string, code []byte) error {
+	return nil
+}
+
+func (s *countingSandbox) Compile(ctx context.Context) (string, error) {
+	s.compiles++
+	return "", nil
+}
+
+func (s *countingSandbox) SaveArtifact(ctx context.Context) ([]byte, error) {
+	return []byte("binary"), nil
+}
+
+func (s *countingSandbox) LoadArtifact(ctx context.Context, artifact []byte) error {
+	s.loads++
+	return nil
+}
+
+func TestPrepareAndCompileUsesCache(t *testing.T) {
+	artifacts, err := NewArtifactCache(t.TempDir(), 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cache := &compileCache{artifacts: artifacts, env: "test"}
+	sb := &countingSandbox{}
+
+	code := []byte("int main() {}")
+	for _, filename := range []string{"a.cpp", "b.cpp"} {
+		if _, err := prepareAndCompile(sb, cache, filename, code); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if sb.compiles != 1 || sb.loads != 1 {
+		t.Errorf("compiled %d times and loaded %d artifacts, want 1 and 1", sb.compiles, sb.loads)
+	}
+}
+
+func TestArchiveRoundTrip(t *testing.T) {
+	src := t.TempDir()
+	os.Mkdir(filepath.Join(src, "pkg"), 0700)
+	os.WriteFile(filepath.Join(src, "main"), []byte("binary"), 0700)
+	os.WriteFile(filepath.Join(src, "pkg", "Main.class"), []byte("class"), 0600)
+
+	data, err := archiveDir(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+	if err := extractArchive(dst, data); err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dst, "main"))
+	if err != nil || info.Mode().Perm()&0100 == 0 {
+		t.Errorf("executable was not restored: %v", err)
+	}
+	if class, err := os.ReadFile(filepath.Join(dst, "pkg", "Main.class")); err != nil || string(class) != "class" {
+		t.Errorf("got %q, %v for a nested file", class, err)
+	}
+}
+
+func TestSandboxEnvIncludesToolchain(t *testing.T) {
+	backend, err := NewBackend(config.Sandbox{Backend: BackendLocal}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := sandboxEnv(backend, "")
+	if err := backend.Setup(t.Context(), ""); err != nil {
+		t.Fatal(err)
+	}
+	after := sandboxEnv(backend, "")
+	if after == before || !strings.Contains(after, ".cpp: ") {
+		t.Errorf("env %q does not include compiler versions", after)
+	}
+}
+
+// failingCompileSandbox 编译时返回指定错误的沙盒
+type failingCompileSandbox struct {
+	countingSandbox
+	output string
+	err    error
+}
+
+func (s *failingCompileSandbox) Compile(ctx context.Context) (string, error) {
+	return s.output, s.err
+}
+
+func TestCompileFailureVerdict(t *testing.T) {
+	problem := &global.Problem{Timelimit: "1", Memorylimit: "64"}
+	testCases := []*global.TestCaseRequest{{InputData: "", OutputData: ""}}
+
+	// 编译器报错属于编译错误
+	sb := &failingCompileSandbox{output: "a.cpp:1: error", err: &compileError{exitCode: 1}}
+	result := CompileAndRun("a.cpp", []byte("code"), sb, nil, problem, testCases, JudgeOptions{})
+	if result.Status != global.CompileError || result.Message != "a.cpp:1: error" {
+		t.Errorf("compiler error: %+v", result)
+	}
+
+	// 沙盒故障属于系统错误，不向用户展示错误信息
+	sb = &failingCompileSandbox{err: errors.New("container is not running")}
+	result = CompileAndRun("a.cpp", []byte("code"), sb, nil, problem, testCases, JudgeOptions{})
+	if result.Status != global.SystemError || result.Message != "" {
+		t.Errorf("sandbox failure: %+v", result)
+	}
+	run := RunWithInput("a.cpp", []byte("code"), sb, nil, problem, "")
+	if run.Status != global.SystemError {
+		t.Errorf("sandbox failure: %+v", run)
+	}
+}
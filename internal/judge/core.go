@@ -5,232 +5,209 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/docker/docker/api/types/build"
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
-	"github.com/moby/go-archive"
 )
 
-// BuildImage 构建Sandbox
-func BuildImage(currentDir string) bool {
-	ctx := context.Background()
+// compileTimeout 编译时间上限
+const compileTimeout = 60 * time.Second
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Println("[FeasOJ] Error creating Docker client: ", err)
-		return false
-	}
+// JudgeOptions 单次评测的执行选项
+type JudgeOptions struct {
+	// Parallel 同时运行的测试点数量，不大于 1 时依次运行
+	// 并行时其余测试点在从池中借用的空闲沙盒中运行，每个沙盒同一时间只运行一个测试点
+	Parallel int
+	// RunAll 运行全部测试点并报告每个测试点的结果，否则在首个未通过的测试点停止
+	RunAll bool
 
-	tar, err := archive.TarWithOptions(currentDir, &archive.TarOptions{})
+	borrow   func(n int) []Sandbox // 借用至多 n 个空闲沙盒，不等待，由沙盒池提供
+	giveBack func(sb Sandbox)      // 归还借用的沙盒
+}
+
+// CompileAndRun 在沙盒中编译代码并运行测试用例，cache 为 nil 时不使用编译产物缓存
+func CompileAndRun(filename string, code []byte, sb Sandbox, cache *compileCache, problem *global.Problem, testCases []*global.TestCaseRequest, opts JudgeOptions) *global.JudgeResult {
+	limits, err := parseLimits(problem)
 	if err != nil {
-		log.Println("[FeasOJ] Error creating tar: ", err)
-		return false
+		return &global.JudgeResult{Status: global.SystemError}
 	}
 
-	buildOptions := build.ImageBuildOptions{
-		Context:    tar,
-		Dockerfile: "Sandbox",
-		Tags:       []string{"judgecore:latest"},
+	if output, err := prepareAndCompile(sb, cache, filename, code); err != nil {
+		if output == "" {
+			return &global.JudgeResult{Status: global.SystemError}
+		}
+		return &global.JudgeResult{Status: global.CompileError, Message: output}
 	}
 
-	log.Println("[FeasOJ] SandBox is being built...")
-	buildResponse, err := cli.ImageBuild(ctx, tar, buildOptions)
-	if err != nil {
-		log.Println("[FeasOJ] Error building Docker image: ", err)
-		return false
+	if opts.Parallel > 1 && len(testCases) > 1 {
+		return runParallel(filename, code, sb, limits, testCases, opts)
 	}
-	defer buildResponse.Body.Close()
 
-	_, err = io.Copy(log.Writer(), buildResponse.Body)
-	if err != nil {
-		log.Printf("[FeasOJ] Error copying build response: %v", err)
+	result := &global.JudgeResult{Status: global.Accepted}
+	for i, testCase := range testCases {
+		caseResult := judgeCase(sb, limits, i, testCase)
+		result.Cases = append(result.Cases, caseResult)
+		if caseResult.Status == global.Accepted {
+			continue
+		}
+		// 整体结果取首个未通过的测试点
+		if result.Status == global.Accepted {
+			result.Status = caseResult.Status
+		}
+		if !opts.RunAll {
+			break
+		}
 	}
 
-	return true
+	return result
 }
 
-// CompileAndRun 编译并运行代码
-func CompileAndRun(filename string, containerID string, problem *global.Problem, testCases []*global.TestCaseRequest) string {
-	taskDir := fmt.Sprintf("/workspace/task_%d", time.Now().UnixNano())
-
-	mkdirCmd := exec.Command("docker", "exec", containerID, "mkdir", "-p", taskDir)
-	if err := mkdirCmd.Run(); err != nil {
-		return global.SystemError
+// judgeCase 运行单个测试点并比对输出
+func judgeCase(sb Sandbox, limits Limits, index int, testCase *global.TestCaseRequest) global.CaseResult {
+	res, stat, status := runCase(sb, limits, testCase.InputData)
+	if status == "" {
+		status = global.Accepted
+		if strings.TrimSpace(string(res.Stdout)) != strings.TrimSpace(testCase.OutputData) {
+			status = global.WrongAnswer
+		}
 	}
 
-	copyCmd := exec.Command("docker", "exec", containerID, "cp", fmt.Sprintf("/workspace/%s", filename), taskDir)
-	if err := copyCmd.Run(); err != nil {
-		return global.SystemError
+	return global.CaseResult{
+		Index:    index,
+		Status:   status,
+		TimeMs:   stat.TimeMs,
+		MemoryKB: stat.MemoryKB,
 	}
+}
 
-	defer func() {
-		if err := resetTaskDirectory(containerID, taskDir); err != nil {
-			log.Printf("[FeasOJ] Reset task dir %s error: %v", taskDir, err)
-		}
-	}()
-
-	ext := filepath.Ext(filename)
-	var compileCmd *exec.Cmd
-
-	timeLimitSeconds, memoryLimitKB, err := parseLimits(problem)
+// RunWithInput 编译代码并使用自定义输入运行一次，不进行答案比对
+func RunWithInput(filename string, code []byte, sb Sandbox, cache *compileCache, problem *global.Problem, input string) *global.RunResult {
+	limits, err := parseLimits(problem)
 	if err != nil {
-		return global.SystemError
-	}
-
-	switch ext {
-	case ".cpp":
-		compileCmd = exec.Command("docker", "exec", containerID, "sh", "-c",
-			fmt.Sprintf("g++ %s/%s -o %s/%s.out", taskDir, filename, taskDir, filename))
-	case ".java":
-		renameCmd := exec.Command("docker", "exec", containerID, "sh", "-c",
-			fmt.Sprintf("mv %s/%s %s/Main.java", taskDir, filename, taskDir))
-		if err := renameCmd.Run(); err != nil {
-			return global.CompileError
-		}
-		compileCmd = exec.Command("docker", "exec", containerID, "sh", "-c",
-			fmt.Sprintf("javac %s/Main.java", taskDir))
-	case ".rs":
-		exeName := strings.TrimSuffix(filename, ".rs")
-		compileCmd = exec.Command("docker", "exec", containerID, "sh", "-c",
-			fmt.Sprintf("rustc %s/%s -o %s/%s", taskDir, filename, taskDir, exeName))
-	case ".php":
-		compileCmd = exec.Command("docker", "exec", containerID, "sh", "-c",
-			fmt.Sprintf("php -l %s/%s", taskDir, filename))
-	case ".pas":
-		exeName := strings.TrimSuffix(filename, ".pas")
-		compileCmd = exec.Command("docker", "exec", containerID, "sh", "-c",
-			fmt.Sprintf("fpc -v0 -O2 %s/%s -o%s/%s", taskDir, filename, taskDir, exeName))
-	}
-
-	if compileCmd != nil {
-		if err := compileCmd.Run(); err != nil {
-			return global.CompileError
+		return &global.RunResult{Status: global.SystemError}
+	}
+
+	if output, err := prepareAndCompile(sb, cache, filename, code); err != nil {
+		if output == "" {
+			return &global.RunResult{Status: global.SystemError}
 		}
+		return &global.RunResult{Status: global.CompileError, Message: output}
 	}
 
-	for _, testCase := range testCases {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeLimitSeconds+1)*time.Second)
-		defer cancel()
+	res, stat, status := runCase(sb, limits, input)
+	if status == "" {
+		status = global.Finished
+	}
 
-		cmdStr := buildRunCommand(ext, filename, taskDir, timeLimitSeconds, memoryLimitKB)
-		if cmdStr == "" {
-			return global.SystemError
-		}
+	result := &global.RunResult{
+		Status:   status,
+		TimeMs:   stat.TimeMs,
+		MemoryKB: stat.MemoryKB,
+	}
+	if res != nil {
+		result.Stdout = string(res.Stdout)
+		result.Stderr = string(res.Stderr)
+	}
+	return result
+}
 
-		runCmd := exec.CommandContext(ctx, "docker", "exec", "-i", containerID, "sh", "-c", cmdStr)
-		runCmd.Stdin = strings.NewReader(testCase.InputData)
-		output, err := runCmd.CombinedOutput()
+// prepareAndCompile 写入代码并编译，代码无法通过编译时返回编译输出，沙盒故障等其余错误返回空输出
+// 缓存中有相同代码的编译产物时直接解包而不编译，编译成功后将产物写入缓存
+func prepareAndCompile(sb Sandbox, cache *compileCache, filename string, code []byte) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-		if ctx.Err() == context.DeadlineExceeded {
-			return global.TimeLimitExceeded
-		}
+	if err := sb.Prepare(ctx, filename, code); err != nil {
+		log.Printf("[FeasOJ] Error preparing task in sandbox %s: %v", sb.ID(), err)
+		return "", err
+	}
 
-		if err != nil {
-			var exitErr *exec.ExitError
-			if errors.As(err, &exitErr) {
-				switch exitErr.ExitCode() {
-				case 124: // timeout 触发
-					return global.TimeLimitExceeded
-				case 137: // SIGKILL, 可能是内存超限
-					return global.MemoryLimitExceeded
-				}
+	ext := filepath.Ext(filename)
+	if compileScript(ext, filename, "") == "" {
+		cache = nil
+	}
+	var key string
+	if cache != nil {
+		key = artifactKey(cache.env, ext, code)
+		if artifact, ok := cache.artifacts.Get(key); ok {
+			err := sb.LoadArtifact(ctx, artifact)
+			if err == nil {
+				return "", nil
 			}
-			return global.RuntimeError
+			log.Printf("[FeasOJ] Failed to load cached artifact in sandbox %s: %v, compiling instead", sb.ID(), err)
 		}
+	}
 
-		expectedOutput := strings.TrimSpace(testCase.OutputData)
-		actualOutput := strings.TrimSpace(string(output))
+	ctx, cancel = context.WithTimeout(context.Background(), compileTimeout)
+	defer cancel()
 
-		if actualOutput != expectedOutput {
-			return global.WrongAnswer
+	output, err := sb.Compile(ctx)
+	if err != nil {
+		var compileErr *compileError
+		if !errors.As(err, &compileErr) {
+			// Docker 守护进程异常、容器已退出等沙盒故障按系统错误处理，归还时由清理检查替换沙盒
+			log.Printf("[FeasOJ] Error compiling in sandbox %s: %v", sb.ID(), err)
+			return "", err
 		}
+		if output == "" {
+			// 保证编译失败时总能与系统错误区分
+			output = err.Error()
+		}
+		return output, err
 	}
 
-	return global.Accepted
+	if cache != nil {
+		artifact, err := sb.SaveArtifact(ctx)
+		if err != nil {
+			log.Printf("[FeasOJ] Failed to save artifact in sandbox %s: %v", sb.ID(), err)
+		} else {
+			cache.artifacts.Put(key, artifact)
+		}
+	}
+	return output, nil
 }
 
-// TerminateContainer 终止并删除Docker容器
-func TerminateContainer(containerID string) {
-	ctx := context.Background()
+// runCase 使用给定输入运行已编译的程序，status 为空表示程序正常退出
+func runCase(sb Sandbox, limits Limits, input string) (*ExecResult, RunStat, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(limits.TimeLimit+1)*time.Second)
+	defer cancel()
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
-	if err != nil {
-		log.Printf("[FeasOJ] Error creating Docker client for termination: %v", err)
-		return
+	res, stat, err := sb.Run(ctx, strings.NewReader(input), limits)
+	if ctx.Err() == context.DeadlineExceeded {
+		return res, RunStat{TimeMs: int64(limits.TimeLimit) * 1000}, global.TimeLimitExceeded
 	}
-
-	if err := cli.ContainerStop(ctx, containerID, container.StopOptions{}); err != nil {
-		log.Printf("[FeasOJ] Error stopping container %s: %v", containerID, err)
+	if err != nil {
+		log.Printf("[FeasOJ] Error running program in sandbox %s: %v", sb.ID(), err)
+		return res, RunStat{}, global.SystemError
 	}
-}
 
-func resetTaskDirectory(containerID, taskDir string) error {
-	resetCmd := exec.Command("docker", "exec", containerID, "sh", "-c", fmt.Sprintf("rm -rf %s", taskDir))
-	if err := resetCmd.Run(); err != nil {
-		log.Printf("[FeasOJ] Error cleaning task directory %s in container %s: %v", taskDir, containerID, err)
-		return err
-	}
-	return nil
+	return res, stat, runVerdict(res.ExitCode, stat, limits.TimeLimit, limits.MemoryLimit)
 }
 
-func parseLimits(problem *global.Problem) (timeLimit int, memoryLimit int, err error) {
+// parseLimits 从题目信息中解析时间限制 (秒) 与内存限制 (KB)
+func parseLimits(problem *global.Problem) (Limits, error) {
 	re := regexp.MustCompile(`\d+`)
 
 	timeMatches := re.FindAllString(problem.Timelimit, -1)
 	if len(timeMatches) == 0 {
-		return 0, 0, fmt.Errorf("no time limit found")
+		return Limits{}, fmt.Errorf("no time limit found")
 	}
-	timeLimit, err = strconv.Atoi(timeMatches[0])
+	timeLimit, err := strconv.Atoi(timeMatches[0])
 	if err != nil {
-		return 0, 0, err
+		return Limits{}, err
 	}
 
 	memMatches := re.FindAllString(problem.Memorylimit, -1)
 	if len(memMatches) == 0 {
-		return 0, 0, fmt.Errorf("no memory limit found")
+		return Limits{}, fmt.Errorf("no memory limit found")
 	}
 	memoryLimitMB, err := strconv.Atoi(memMatches[0])
 	if err != nil {
-		return 0, 0, err
+		return Limits{}, err
 	}
-	memoryLimit = memoryLimitMB * 1024 // 转换为KB
 
-	return timeLimit, memoryLimit, nil
+	return Limits{TimeLimit: timeLimit, MemoryLimit: memoryLimitMB * 1024}, nil // 内存转换为KB
 }
-
-func buildRunCommand(ext, filename, taskDir string, timeLimit, memoryLimit int) string {
-	switch ext {
-	case ".cpp":
-		return fmt.Sprintf("ulimit -v %d && timeout -s SIGKILL %ds %s/%s.out", memoryLimit, timeLimit, taskDir, filename)
-	case ".java":
-		heapSizeMB := max(memoryLimit/1024, 32)
-		return fmt.Sprintf(
-			"ulimit -v %d && timeout -s SIGKILL %ds java -cp %s -Xms%dm -Xmx%dm -XX:MaxRAMPercentage=80.0 Main",
-			memoryLimit, timeLimit, taskDir, heapSizeMB, heapSizeMB,
-		)
-	case ".py":
-		return fmt.Sprintf("ulimit -v %d && timeout -s SIGKILL %ds python %s/%s", memoryLimit, timeLimit, taskDir, filename)
-	case ".rs":
-		exeName := strings.TrimSuffix(filename, ".rs")
-		return fmt.Sprintf("ulimit -v %d && timeout -s SIGKILL %ds %s/%s",
-			memoryLimit, timeLimit, taskDir, exeName)
-	case ".php":
-		return fmt.Sprintf("ulimit -v %d && timeout -s SIGKILL %ds php %s/%s",
-			memoryLimit, timeLimit, taskDir, filename)
-	case ".pas":
-		exeName := strings.TrimSuffix(filename, ".pas")
-		return fmt.Sprintf("ulimit -v %d && timeout -s SIGKILL %ds %s/%s",
-			memoryLimit, timeLimit, taskDir, exeName)
-	default:
-		return ""
-	}
-}
\ No newline at end of file
@@ -0,0 +1,127 @@
+package judge
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// maxOutputSize 单次执行收集的 stdout/stderr 上限，超出部分被丢弃
+const maxOutputSize = 64 * 1024 * 1024
+
+var (
+	dockerOnce   sync.Once
+	dockerClient *client.Client
+	dockerErr    error
+)
+
+// DockerClient 获取进程内共享的 Docker 客户端
+func DockerClient() (*client.Client, error) {
+	dockerOnce.Do(func() {
+		dockerClient, dockerErr = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	})
+	return dockerClient, dockerErr
+}
+
+// dockerExec 通过 Docker Engine API 在容器内执行命令，流式传输标准输入输出并返回退出码
+// 上下文取消时会断开连接并返回上下文错误，但不会终止容器内的进程，调用方需在命令中自行限制运行时间
+func dockerExec(ctx context.Context, containerID string, cmd []string, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	cli, err := DockerClient()
+	if err != nil {
+		return -1, err
+	}
+
+	created, err := cli.ContainerExecCreate(ctx, containerID, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdin:  stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return -1, err
+	}
+
+	attach, err := cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return -1, err
+	}
+	defer attach.Close()
+
+	// 上下文取消时关闭连接以中断阻塞的读写
+	stop := context.AfterFunc(ctx, attach.Close)
+	defer stop()
+
+	if stdin != nil {
+		go func() {
+			io.Copy(attach.Conn, stdin)
+			attach.CloseWrite()
+		}()
+	}
+
+	_, err = stdcopy.StdCopy(stdout, stderr, attach.Reader)
+	if ctx.Err() != nil {
+		return -1, ctx.Err()
+	}
+	if err != nil {
+		return -1, err
+	}
+
+	// 输出流结束后进程可能尚未被标记为退出
+	for {
+		inspect, err := cli.ContainerExecInspect(ctx, created.ID)
+		if err != nil {
+			return -1, err
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+// execInContainer 在容器内通过 sh 执行脚本，分别收集 stdout 与 stderr
+func execInContainer(ctx context.Context, containerID string, script string, stdin io.Reader) (*ExecResult, error) {
+	stdout := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: maxOutputSize}
+
+	exitCode, err := dockerExec(ctx, containerID, []string{"sh", "-c", script}, stdin, stdout, stderr)
+	result := &ExecResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: exitCode}
+	return result, err
+}
+
+// limitedBuffer 超出上限后丢弃写入内容的缓冲区
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		b.Buffer.Write(p[:min(len(p), room)])
+	}
+	return len(p), nil
+}
+
+// execScript 在容器内执行脚本，非零退出码视为错误
+func execScript(ctx context.Context, containerID string, script string) error {
+	res, err := execInContainer(ctx, containerID, script, nil)
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("exit code %d: %s", res.ExitCode, strings.TrimSpace(string(res.Stderr)))
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package judge
+
+import (
+	"JudgeCore/internal/global"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// statMarker 运行统计信息在 stderr 中的起始标记
+const statMarker = "__JUDGECORE_STAT__"
+
+// ExecResult 沙盒内命令的执行结果
+type ExecResult struct {
+	Stdout   []byte
+	Stderr   []byte
+	ExitCode int
+}
+
+// RunStat 程序运行耗时、内存峰值与终止信号
+type RunStat struct {
+	TimeMs   int64
+	MemoryKB int64
+	Signal   int
+}
+
+// sigsys seccomp 拦截系统调用时终止进程的信号
+const sigsys = 31
+
+// wrapRunCommand 为运行命令加上内存、时间限制与资源统计
+func wrapRunCommand(cmd, taskDir string, timeLimit, memoryLimit int) string {
+	statFile := taskDir + "/.stat"
+	return fmt.Sprintf(
+		"cd %s || exit 1; export HOME=%s TMPDIR=%s; ulimit -v %d || exit 1; /usr/bin/time -f '%%e %%M' -o %s timeout -s SIGKILL %ds %s; code=$?; printf '\\n%s ' >&2; cat %s >&2; exit $code",
+		taskDir, taskDir, taskDir, memoryLimit, statFile, timeLimit, cmd, statMarker, statFile,
+	)
+}
+
+// extractStat 从 stderr 中剥离运行统计信息
+func extractStat(stderr []byte) ([]byte, RunStat) {
+	var stat RunStat
+	idx := bytes.LastIndex(stderr, []byte(statMarker))
+	if idx < 0 {
+		return stderr, stat
+	}
+
+	// 程序非正常退出时 time 会先输出一行退出说明，统计值总在最后两列
+	statText := string(stderr[idx+len(statMarker):])
+	if _, after, found := strings.Cut(statText, "terminated by signal "); found {
+		fmt.Sscanf(after, "%d", &stat.Signal)
+	}
+	fields := strings.Fields(statText)
+	if n := len(fields); n >= 2 {
+		if seconds, err := strconv.ParseFloat(fields[n-2], 64); err == nil {
+			stat.TimeMs = int64(seconds * 1000)
+		}
+		if memory, err := strconv.ParseInt(fields[n-1], 10, 64); err == nil {
+			stat.MemoryKB = memory
+		}
+	}
+
+	// 去掉标记前由 printf 追加的换行
+	return bytes.TrimSuffix(stderr[:idx], []byte("\n")), stat
+}
+
+// runVerdict 根据退出码与资源统计判断运行状态，正常退出时返回空字符串
+func runVerdict(exitCode int, stat RunStat, timeLimit, memoryLimit int) string {
+	if exitCode == 0 {
+		return ""
+	}
+	if stat.Signal == sigsys || exitCode == 128+sigsys {
+		return global.RestrictedFunction
+	}
+	if exitCode == 124 || stat.TimeMs >= int64(timeLimit)*1000 {
+		return global.TimeLimitExceeded
+	}
+	// time 对被信号终止的进程返回信号值，sh 则返回 128+信号值
+	if exitCode == 9 || exitCode == 137 || stat.MemoryKB >= int64(memoryLimit) {
+		return global.MemoryLimitExceeded
+	}
+	return global.RuntimeError
+}
+
+// executableName 编译产物的文件名，与源文件名无关，使缓存的编译产物可用于同一代码的其他提交
+const executableName = "main"
+
+// compileScript 生成编译任务目录中代码的脚本，无需编译的语言返回空字符串
+func compileScript(ext, filename, taskDir string) string {
+	switch ext {
+	case ".cpp":
+		return fmt.Sprintf("g++ %s/%s -o %s/%s", taskDir, filename, taskDir, executableName)
+	case ".java":
+		return fmt.Sprintf("mv %s/%s %s/Main.java && javac %s/Main.java", taskDir, filename, taskDir, taskDir)
+	case ".rs":
+		return fmt.Sprintf("rustc %s/%s -o %s/%s", taskDir, filename, taskDir, executableName)
+	case ".php":
+		return fmt.Sprintf("php -l %s/%s", taskDir, filename)
+	case ".pas":
+		return fmt.Sprintf("fpc -v0 -O2 %s/%s -o%s/%s", taskDir, filename, taskDir, executableName)
+	default:
+		return ""
+	}
+}
+
+// compilerVersionCommands 输出各语言编译器版本的命令，用于区分宿主机工具链编译的产物
+var compilerVersionCommands = map[string]string{
+	".cpp":  "g++ --version",
+	".java": "javac -version",
+	".rs":   "rustc --version",
+	".php":  "php --version",
+	".pas":  "fpc -iV",
+}
+
+// buildRunCommand 生成运行程序的命令，时间与内存限制由 wrapRunCommand 统一附加
+func buildRunCommand(ext, filename, taskDir string, memoryLimit int) string {
+	switch ext {
+	case ".cpp", ".rs", ".pas":
+		return fmt.Sprintf("%s/%s", taskDir, executableName)
+	case ".java":
+		heapSizeMB := max(memoryLimit/1024, 32)
+		return fmt.Sprintf("java -cp %s -Xms%dm -Xmx%dm -XX:MaxRAMPercentage=80.0 Main", taskDir, heapSizeMB, heapSizeMB)
+	case ".py":
+		return fmt.Sprintf("python %s/%s", taskDir, filename)
+	case ".php":
+		return fmt.Sprintf("php %s/%s", taskDir, filename)
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,56 @@
+package judge
+
+import (
+	"JudgeCore/internal/global"
+	"testing"
+)
+
+func TestExtractStat(t *testing.T) {
+	// 程序正常退出
+	stderr, stat := extractStat([]byte("warning\n" + statMarker + " 0.52 10240\n"))
+	if string(stderr) != "warning" {
+		t.Error(string(stderr))
+	}
+	if stat.TimeMs != 520 || stat.MemoryKB != 10240 {
+		t.Error(stat)
+	}
+
+	// 程序非正常退出时 time 会先输出退出说明
+	_, stat = extractStat([]byte(statMarker + " Command exited with non-zero status 1\n0.01 2048\n"))
+	if stat.TimeMs != 10 || stat.MemoryKB != 2048 {
+		t.Error(stat)
+	}
+
+	// 被信号终止
+	_, stat = extractStat([]byte(statMarker + " Command terminated by signal 31\n0.00 1024\n"))
+	if stat.Signal != 31 || stat.MemoryKB != 1024 {
+		t.Error(stat)
+	}
+
+	// 没有统计信息
+	stderr, stat = extractStat([]byte("panic"))
+	if string(stderr) != "panic" || stat.TimeMs != 0 {
+		t.Error(string(stderr), stat)
+	}
+}
+
+func TestRunVerdict(t *testing.T) {
+	cases := []struct {
+		exitCode int
+		stat     RunStat
+		want     string
+	}{
+		{0, RunStat{TimeMs: 100}, ""},
+		{124, RunStat{}, global.TimeLimitExceeded},
+		{9, RunStat{TimeMs: 1000}, global.TimeLimitExceeded},
+		{9, RunStat{TimeMs: 100}, global.MemoryLimitExceeded},
+		{1, RunStat{MemoryKB: 262144}, global.MemoryLimitExceeded},
+		{1, RunStat{TimeMs: 100}, global.RuntimeError},
+		{31, RunStat{Signal: 31}, global.RestrictedFunction},
+	}
+	for _, c := range cases {
+		if got := runVerdict(c.exitCode, c.stat, 1, 262144); got != c.want {
+			t.Error(c.exitCode, c.stat, got)
+		}
+	}
+}
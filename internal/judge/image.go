@@ -0,0 +1,104 @@
+package judge
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/docker/docker/api/types/build"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/jsonmessage"
+)
+
+// sandboxDockerfile 内置的沙盒镜像 Dockerfile
+//
+//go:embed sandbox.Dockerfile
+var sandboxDockerfile []byte
+
+// imageRef 获取语言沙盒镜像的引用，language 为空时使用包含所有工具链的镜像
+// 标签取 Dockerfile 内容与软件包列表的哈希，二者变化后会构建新的镜像，配置了仓库时加上仓库前缀
+func imageRef(registry string, dockerfile []byte, language string) string {
+	name := "judgecore"
+	if language != "" {
+		name += "-" + language
+	}
+
+	hash := sha256.New()
+	hash.Write(dockerfile)
+	hash.Write([]byte{0})
+	hash.Write([]byte(imagePackages(language)))
+	ref := name + ":" + hex.EncodeToString(hash.Sum(nil))[:12]
+
+	if registry != "" {
+		ref = strings.TrimSuffix(registry, "/") + "/" + ref
+	}
+	return ref
+}
+
+// buildImage 使用只包含 Dockerfile 的构建上下文构建镜像，packages 非空时覆盖要安装的软件包
+func buildImage(ctx context.Context, ref string, dockerfile []byte, packages string) error {
+	cli, err := DockerClient()
+	if err != nil {
+		return err
+	}
+
+	var buildContext bytes.Buffer
+	tw := tar.NewWriter(&buildContext)
+	if err := tw.WriteHeader(&tar.Header{Name: "Dockerfile", Mode: 0644, Size: int64(len(dockerfile))}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(dockerfile); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	buildOptions := build.ImageBuildOptions{
+		Dockerfile: "Dockerfile",
+		Tags:       []string{ref},
+		Remove:     true,
+	}
+	if packages != "" {
+		buildOptions.BuildArgs = map[string]*string{"PACKAGES": &packages}
+	}
+
+	log.Printf("[FeasOJ] SandBox %s is being built...", ref)
+	resp, err := cli.ImageBuild(ctx, &buildContext, buildOptions)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// 构建失败时 HTTP 状态仍为 200，错误只出现在输出流中
+	if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, log.Writer(), 0, false, nil); err != nil {
+		return fmt.Errorf("failed to build %s: %w", ref, err)
+	}
+	return nil
+}
+
+// pullImage 从镜像仓库拉取预构建的镜像
+func pullImage(ctx context.Context, ref string) error {
+	cli, err := DockerClient()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[FeasOJ] SandBox %s is being pulled...", ref)
+	resp, err := cli.ImagePull(ctx, ref, image.PullOptions{})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	if err := jsonmessage.DisplayJSONMessagesStream(resp, log.Writer(), 0, false, nil); err != nil {
+		return fmt.Errorf("failed to pull %s: %w", ref, err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package judge
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestImageRef(t *testing.T) {
+	ref := imageRef("", sandboxDockerfile, "cpp")
+	if !strings.HasPrefix(ref, "judgecore-cpp:") || ref != imageRef("", sandboxDockerfile, "cpp") {
+		t.Errorf("unexpected image ref %s", ref)
+	}
+	if ref == imageRef("", append([]byte("# changed\n"), sandboxDockerfile...), "cpp") {
+		t.Error("image tag did not change with the Dockerfile")
+	}
+	if shared := imageRef("", sandboxDockerfile, ""); !strings.HasPrefix(shared, "judgecore:") || shared[len("judgecore:"):] == ref[len("judgecore-cpp:"):] {
+		t.Errorf("unexpected shared image ref %s", shared)
+	}
+	if got := imageRef("127.0.0.1:5000/", sandboxDockerfile, "cpp"); got != "127.0.0.1:5000/"+ref {
+		t.Errorf("got %s with registry", got)
+	}
+}
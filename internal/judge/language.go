@@ -0,0 +1,163 @@
+package judge
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// languageExts 提交记录中的语言名称与源文件扩展名的对应关系
+var languageExts = map[string]string{
+	"c++":    ".cpp",
+	"cpp":    ".cpp",
+	"java":   ".java",
+	"python": ".py",
+	"rust":   ".rs",
+	"php":    ".php",
+	"pascal": ".pas",
+}
+
+// LanguageExt 根据语言名称获取源文件扩展名
+func LanguageExt(language string) (string, bool) {
+	ext, ok := languageExts[strings.ToLower(strings.TrimSpace(language))]
+	return ext, ok
+}
+
+// languageImage 单个语言沙盒镜像的名称与需要安装的软件包
+type languageImage struct {
+	name     string
+	packages string
+}
+
+// languageImages 源文件扩展名与语言镜像的对应关系
+var languageImages = map[string]languageImage{
+	".cpp":  {"cpp", "build-base"},
+	".java": {"java", "openjdk17"},
+	".py":   {"python", "python3 py3-pip"},
+	".rs":   {"rust", "build-base rust"},
+	".php":  {"php", "php php-cli php-common php-json php-phar php-iconv php-openssl php-mbstring php-tokenizer php-xml php-curl"},
+	".pas":  {"pascal", "fpc binutils"},
+}
+
+// ImageLanguage 将语言名称或源文件扩展名规范化为语言镜像名，如 c++ 与 .cpp 均对应 cpp
+func ImageLanguage(language string) (string, bool) {
+	ext := language
+	if !strings.HasPrefix(language, ".") {
+		var ok bool
+		if ext, ok = LanguageExt(language); !ok {
+			return "", false
+		}
+	}
+	image, ok := languageImages[ext]
+	return image.name, ok
+}
+
+// imagePackages 获取语言镜像需要安装的软件包，language 为空时返回空字符串，使用 Dockerfile 中的默认列表
+func imagePackages(language string) string {
+	for _, image := range languageImages {
+		if image.name == language {
+			return image.packages
+		}
+	}
+	return ""
+}
+
+// sourceNamePattern 代码文件名格式，仅允许字母、数字、下划线与连字符，且只含一个扩展名
+var sourceNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,127}\.[a-z]{1,8}$`)
+
+// ValidSourceName 判断代码文件名是否安全，可直接用于路径拼接与容器内命令
+func ValidSourceName(filename string) bool {
+	return sourceNamePattern.MatchString(filename)
+}
+
+// SourceName 为不落盘的代码生成唯一文件名
+func SourceName(prefix, ext string) string {
+	return fmt.Sprintf("%s_%d%s", prefix, time.Now().UnixNano(), ext)
+}
+
+// SourceObjectName 代码内容寻址副本的文件名
+func SourceObjectName(code []byte, ext string) string {
+	sum := sha256.Sum256(code)
+	return "." + hex.EncodeToString(sum[:]) + ext
+}
+
+// RemoveSource 评测结束后删除代码文件，文件已被新上传覆盖时保留
+// 内容寻址副本可能被其他文件名或正在进行的上传引用，由 SweepSources 在没有引用后清理
+func RemoveSource(codeDir, filename string, code []byte) {
+	path := filepath.Join(codeDir, filename)
+	if current, err := os.ReadFile(path); err == nil && bytes.Equal(current, code) {
+		os.Remove(path)
+	}
+}
+
+var (
+	// sourceObjectPattern 内容寻址副本的文件名格式
+	sourceObjectPattern = regexp.MustCompile(`^\.[0-9a-f]{64}\.[a-z]{1,8}$`)
+	// sourceTempPattern 上传过程中的临时文件与临时硬链接的文件名格式
+	sourceTempPattern = regexp.MustCompile(`^\.([0-9a-f]{64}\.[A-Z2-7]+\.link|upload-[0-9]+)$`)
+)
+
+// defaultSourceTTL 未配置时未被引用的内容寻址副本的保留时间
+const defaultSourceTTL = time.Hour
+
+// SweepSources 定期清理代码目录中超过 ttl 且没有其他文件名指向的内容寻址副本，以及上传中断留下的临时文件
+// 任务被拒绝或未进入队列的上传不会被评测删除，由此回收
+func SweepSources(codeDir string, ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultSourceTTL
+	}
+
+	ticker := time.NewTicker(max(ttl/4, time.Minute))
+	defer ticker.Stop()
+	for range ticker.C {
+		if removed := sweepSources(codeDir, ttl, time.Now()); removed > 0 {
+			log.Printf("[FeasOJ] Removed %d unreferenced source files", removed)
+		}
+	}
+}
+
+// sweepSources 执行一次清理，返回删除的文件数量
+func sweepSources(codeDir string, ttl time.Duration, now time.Time) int {
+	entries, err := os.ReadDir(codeDir)
+	if err != nil {
+		log.Printf("[FeasOJ] Failed to read code directory: %v", err)
+		return 0
+	}
+
+	removed := 0
+	for _, entry := range entries {
+		object := sourceObjectPattern.MatchString(entry.Name())
+		if !object && !sourceTempPattern.MatchString(entry.Name()) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || !info.Mode().IsRegular() || now.Sub(info.ModTime()) < ttl {
+			continue
+		}
+		// 内容寻址副本仍有文件名指向时说明任务尚未评测
+		if links, ok := linkCount(info); object && (!ok || links > 1) {
+			continue
+		}
+		if os.Remove(filepath.Join(codeDir, entry.Name())) == nil {
+			removed++
+		}
+	}
+	return removed
+}
+
+// SupportedExt 判断源文件扩展名是否属于支持的语言
+func SupportedExt(ext string) bool {
+	for _, supported := range languageExts {
+		if supported == ext {
+			return true
+		}
+	}
+	return false
+}
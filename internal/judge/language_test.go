@@ -0,0 +1,39 @@
+package judge
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSweepSources(t *testing.T) {
+	dir := t.TempDir()
+	code := []byte("int main() {}")
+	object := filepath.Join(dir, SourceObjectName(code, ".cpp"))
+	queued := filepath.Join(dir, SourceObjectName([]byte("queued"), ".cpp"))
+	for _, path := range []string{object, queued} {
+		if err := os.WriteFile(path, code, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Link(queued, filepath.Join(dir, "1_2.cpp")); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	if removed := sweepSources(dir, time.Hour, now); removed != 0 {
+		t.Fatalf("removed %d fresh files", removed)
+	}
+
+	// 超过保留时间后只删除没有其他文件名指向的副本
+	if removed := sweepSources(dir, time.Hour, now.Add(2*time.Hour)); removed != 1 {
+		t.Fatalf("removed %d files, want 1", removed)
+	}
+	if _, err := os.Stat(object); !os.IsNotExist(err) {
+		t.Error("unreferenced object was kept")
+	}
+	if _, err := os.Stat(queued); err != nil {
+		t.Error("referenced object was removed")
+	}
+}
@@ -0,0 +1,99 @@
+package judge
+
+import (
+	"JudgeCore/internal/global"
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// runParallel 在已编译的沙盒与借用的沙盒中并行运行测试点
+// 未设置 RunAll 时，出现未通过的测试点后不再启动新的测试点，已在运行的测试点照常完成
+// 编译产物被复制到借用的沙盒中，各测试点的内存限制独立计算
+// 只有 Docker 与 jail 后端配置了 nano_cpus 时各测试点才有独立的 CPU 配额，否则并行的测试点共享主机 CPU，计时可能受到影响
+// 因此并行数量受 max_parallel_cases 限制
+// 借不到空闲沙盒时退化为在当前沙盒中依次运行全部测试点
+func runParallel(filename string, code []byte, sb Sandbox, limits Limits, testCases []*global.TestCaseRequest, opts JudgeOptions) *global.JudgeResult {
+	sandboxes := []Sandbox{sb}
+	if opts.borrow != nil {
+		borrowed := opts.borrow(min(opts.Parallel, len(testCases)) - 1)
+		defer func() {
+			for _, helper := range borrowed {
+				opts.giveBack(helper)
+			}
+		}()
+		sandboxes = append(sandboxes, prepareHelpers(filename, code, sb, borrowed)...)
+	}
+
+	idle := make(chan Sandbox, len(sandboxes))
+	for _, s := range sandboxes {
+		idle <- s
+	}
+
+	cases := make([]global.CaseResult, len(testCases))
+	var (
+		wg     sync.WaitGroup
+		failed atomic.Bool
+	)
+	for i, testCase := range testCases {
+		s := <-idle
+		if failed.Load() && !opts.RunAll {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cases[i] = judgeCase(s, limits, i, testCase)
+			if cases[i].Status != global.Accepted {
+				failed.Store(true)
+			}
+			idle <- s
+		}()
+	}
+	wg.Wait()
+
+	result := &global.JudgeResult{Status: global.Accepted}
+	for _, c := range cases {
+		if c.Status == "" {
+			// 未启动的测试点
+			continue
+		}
+		if c.Status != global.Accepted && result.Status == global.Accepted {
+			result.Status = c.Status
+		}
+		result.Cases = append(result.Cases, c)
+	}
+	return result
+}
+
+// prepareHelpers 将编译产物复制到借用的沙盒中，返回准备成功的沙盒
+func prepareHelpers(filename string, code []byte, sb Sandbox, borrowed []Sandbox) []Sandbox {
+	if len(borrowed) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	artifact, err := sb.SaveArtifact(ctx)
+	if err != nil {
+		log.Printf("[FeasOJ] Failed to save artifact in sandbox %s: %v, running cases sequentially", sb.ID(), err)
+		return nil
+	}
+
+	var helpers []Sandbox
+	for _, helper := range borrowed {
+		if err := helper.Prepare(ctx, filename, code); err != nil {
+			log.Printf("[FeasOJ] Error preparing task in sandbox %s: %v", helper.ID(), err)
+			continue
+		}
+		if err := helper.LoadArtifact(ctx, artifact); err != nil {
+			log.Printf("[FeasOJ] Failed to load artifact in sandbox %s: %v", helper.ID(), err)
+			continue
+		}
+		helpers = append(helpers, helper)
+	}
+	return helpers
+}
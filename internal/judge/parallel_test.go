@@ -0,0 +1,122 @@
+package judge
+
+import (
+	"JudgeCore/internal/global"
+	"context"
+	"io"
+	"testing"
+)
+
+// echoSandbox 将输入原样输出的沙盒
+type echoSandbox struct {
+	countingSandbox
+	id string
+}
+
+func (s *echoSandbox) ID() string {
+	return s.id
+}
+
+func (s *echoSandbox) Run(ctx context.Context, stdin io.Reader, limits Limits) (*ExecResult, RunStat, error) {
+	input, err := io.ReadAll(stdin)
+	return &ExecResult{Stdout: input}, RunStat{}, err
+}
+
+func TestRunParallel(t *testing.T) {
+	sb := &echoSandbox{id: "main"}
+	helpers := []Sandbox{&echoSandbox{id: "a"}, &echoSandbox{id: "b"}}
+	var returned int
+	opts := JudgeOptions{
+		Parallel: 3,
+		RunAll:   true,
+		borrow: func(n int) []Sandbox {
+			return helpers[:n]
+		},
+		giveBack: func(Sandbox) {
+			returned++
+		},
+	}
+
+	testCases := []*global.TestCaseRequest{
+		{InputData: "1", OutputData: "1"},
+		{InputData: "2", OutputData: "3"},
+		{InputData: "3", OutputData: "3"},
+		{InputData: "4", OutputData: "5"},
+	}
+	problem := &global.Problem{Timelimit: "1", Memorylimit: "256"}
+	result := CompileAndRun("a.cpp", []byte("code"), sb, nil, problem, testCases, opts)
+
+	// 运行全部测试点，结果按测试点顺序给出
+	if result.Status != global.WrongAnswer || len(result.Cases) != len(testCases) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	for i, want := range []string{global.Accepted, global.WrongAnswer, global.Accepted, global.WrongAnswer} {
+		if result.Cases[i].Index != i || result.Cases[i].Status != want {
+			t.Errorf("case %d: got %+v, want %s", i, result.Cases[i], want)
+		}
+	}
+	for _, helper := range helpers {
+		if helper.(*echoSandbox).loads != 1 {
+			t.Errorf("artifact was not loaded into sandbox %s", helper.ID())
+		}
+	}
+	if returned != len(helpers) {
+		t.Errorf("returned %d borrowed sandboxes, want %d", returned, len(helpers))
+	}
+}
+
+func TestCompileAndRunCasePolicy(t *testing.T) {
+	testCases := []*global.TestCaseRequest{
+		{InputData: "1", OutputData: "1"},
+		{InputData: "2", OutputData: "3"},
+		{InputData: "3", OutputData: "4"},
+	}
+	problem := &global.Problem{Timelimit: "1", Memorylimit: "256"}
+
+	result := CompileAndRun("a.cpp", []byte("code"), &echoSandbox{id: "main"}, nil, problem, testCases, JudgeOptions{})
+	if result.Status != global.WrongAnswer || len(result.Cases) != 2 {
+		t.Errorf("stop on failure: unexpected result %+v", result)
+	}
+
+	result = CompileAndRun("a.cpp", []byte("code"), &echoSandbox{id: "main"}, nil, problem, testCases, JudgeOptions{RunAll: true})
+	if result.Status != global.WrongAnswer || len(result.Cases) != len(testCases) {
+		t.Errorf("run all: unexpected result %+v", result)
+	}
+}
+
+func TestLoadJudgeOptionsClampsParallel(t *testing.T) {
+	problem := &global.Problem{}
+	for _, c := range []struct{ parallel, maxParallel, want int }{
+		{0, 4, 0},
+		{2, 4, 2},
+		{16, 4, 4},
+		{16, 0, 1},
+	} {
+		opts, err := LoadJudgeOptions(nil, problem, "", c.parallel, c.maxParallel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.Parallel != c.want {
+			t.Errorf("parallel %d with limit %d: got %d, want %d", c.parallel, c.maxParallel, opts.Parallel, c.want)
+		}
+	}
+}
+
+func TestLoadLimitsKeepsInlineLimits(t *testing.T) {
+	problem, err := LoadLimits(nil, 0, 2, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problem.Timelimit != "2" || problem.Memorylimit != "64" {
+		t.Errorf("limits %s/%s, want 2/64", problem.Timelimit, problem.Memorylimit)
+	}
+
+	// 未给定时使用默认值
+	problem, err = LoadLimits(nil, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if problem.Timelimit != "1" || problem.Memorylimit != "256" {
+		t.Errorf("default limits %s/%s, want 1/256", problem.Timelimit, problem.Memorylimit)
+	}
+}
@@ -2,143 +2,311 @@ package judge
 
 import (
 	"JudgeCore/internal/config"
+	"JudgeCore/internal/global"
 	"context"
+	"errors"
+	"fmt"
 	"log"
-	"os/exec"
+	"maps"
+	"path/filepath"
+	"slices"
 	"sync"
+	"time"
+)
+
+// defaultAcquireTimeout 未配置时获取沙盒的最长等待时间
+const defaultAcquireTimeout = 60 * time.Second
 
-	"github.com/docker/docker/api/types/container"
-	"github.com/docker/docker/client"
+var (
+	// ErrPoolClosed 沙盒池已关闭
+	ErrPoolClosed = errors.New("sandbox pool is closed")
+	// ErrNoPool 没有与语言对应的沙盒子池
+	ErrNoPool = errors.New("no sandbox pool for language")
 )
 
-// JudgePool 容器池结构
+// AcquireError 在等待时间内未能获取沙盒，任务尚未执行，可以稍后重试
+type AcquireError struct {
+	Pool string
+	Err  error
+}
+
+func (e *AcquireError) Error() string {
+	return fmt.Sprintf("failed to acquire %s sandbox: %v", e.Pool, e.Err)
+}
+
+func (e *AcquireError) Unwrap() error {
+	return e.Err
+}
+
+// JudgePool 沙盒池，按语言镜像划分为多个子池
+// 未配置语言子池时，所有语言共用一个使用完整镜像的子池
 type JudgePool struct {
-	pool          chan string
-	mutex         sync.Mutex
 	sandboxConfig config.Sandbox
+	backend       Backend
 	codeDir       string
-	containerIDs  sync.Map
+	pools         map[string]*subPool // 语言镜像名 -> 子池，"" 为共享子池
+	owners        sync.Map            // 沙盒ID -> 所属子池
+	mutex         sync.Mutex
+	onResize      func(int)
+	done          chan struct{}
 }
 
-// NewJudgePool 创建一个新的 JudgePool 实例
-func NewJudgePool(sandboxConfig config.Sandbox, codeDir string) *JudgePool {
-	return &JudgePool{
+// NewJudgePool 根据沙盒配置创建一个新的 JudgePool 实例
+func NewJudgePool(sandboxConfig config.Sandbox, serviceID, codeDir string) (*JudgePool, error) {
+	backend, err := NewBackend(sandboxConfig, serviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &JudgePool{
 		sandboxConfig: sandboxConfig,
+		backend:       backend,
 		codeDir:       codeDir,
+		pools:         make(map[string]*subPool),
+		done:          make(chan struct{}),
+	}
+	for language := range sandboxConfig.Pools {
+		name, ok := ImageLanguage(language)
+		if !ok {
+			return nil, fmt.Errorf("unknown language in sandbox pools: %s", language)
+		}
+		p.pools[name] = newSubPool(sandboxConfig, backend, name)
+	}
+	if len(p.pools) == 0 {
+		p.pools[""] = newSubPool(sandboxConfig, backend, "")
+	}
+	for _, sub := range p.pools {
+		sub.onResize = p.resized
 	}
-}
 
-// Initialize 预热容器池
-func (p *JudgePool) Initialize(n int) {
-	p.pool = make(chan string, n)
-	for i := 0; i < n; i++ {
-		containerID, err := p.startContainer()
+	if sandboxConfig.ArtifactCache > 0 {
+		artifacts, err := NewArtifactCache(sandboxConfig.ArtifactCacheDir, sandboxConfig.ArtifactCache)
 		if err != nil {
-			log.Printf("[FeasOJ] Error starting container during preheat: %v", err)
-			continue
+			return nil, fmt.Errorf("failed to open artifact cache: %w", err)
 		}
-		p.pool <- containerID
+		for _, sub := range p.pools {
+			sub.cache = &compileCache{artifacts: artifacts, env: sandboxEnv(backend, sub.language)}
+		}
+	}
+	return p, nil
+}
+
+// toolchainBackend 使用宿主机工具链的后端，Setup 后可获取编译器版本
+type toolchainBackend interface {
+	toolchainVersion() string
+}
+
+// sandboxEnv 标识编译产物所依赖的沙盒环境，Docker 后端使用镜像引用，镜像内容变化后缓存随之失效
+// 使用宿主机工具链的后端附加编译器版本，升级编译器后缓存同样失效
+func sandboxEnv(backend Backend, language string) string {
+	switch b := backend.(type) {
+	case *DockerBackend:
+		return b.image(language)
+	case toolchainBackend:
+		return backend.Name() + "/" + language + "\n" + b.toolchainVersion()
 	}
-	log.Printf("[FeasOJ] Preheated %d containers", len(p.pool))
+	return backend.Name() + "/" + language
 }
 
-// AcquireContainer 从池中获取一个空闲容器（若池为空则阻塞等待）
-func (p *JudgePool) AcquireContainer() string {
-	containerID := <-p.pool
-	return containerID
+// MaxParallelCases 获取单次评测同时运行的测试点数量上限，至少为1
+func (p *JudgePool) MaxParallelCases() int {
+	return max(p.sandboxConfig.MaxParallelCases, 1)
 }
 
-// ReleaseContainer 将容器归还到池中
-func (p *JudgePool) ReleaseContainer(containerID string) {
-	// 清理容器中所有残留的任务目录
-	if err := p.resetContainer(containerID); err != nil {
-		log.Printf("[FeasOJ] Reset failed for container %s: %v, terminating it", containerID, err)
-		p.containerIDs.Delete(containerID)
-		go TerminateContainer(containerID)
+// Backend 获取沙盒池使用的后端
+func (p *JudgePool) Backend() Backend {
+	return p.backend
+}
 
-		// 尝试启动一个新容器替换
-		newContainerID, err := p.startContainer()
-		if err != nil {
-			log.Printf("[FeasOJ] Failed to start new container to replace failed one: %v", err)
-			return
+// Setup 为每个子池准备沙盒镜像等资源
+func (p *JudgePool) Setup() error {
+	for _, language := range p.Languages() {
+		sub := p.pools[language]
+		if err := p.backend.Setup(context.Background(), language); err != nil {
+			return fmt.Errorf("failed to set up %s sandbox: %w", sub.name(), err)
+		}
+		// 编译器版本在 Setup 后才能确定
+		if sub.cache != nil {
+			sub.cache.env = sandboxEnv(p.backend, language)
 		}
-		containerID = newContainerID
 	}
+	return nil
+}
 
-	// 将有效容器归还
-	p.mutex.Lock()
-	defer p.mutex.Unlock()
-	select {
-	case p.pool <- containerID:
-	default:
-		log.Printf("[FeasOJ] Pool is full or closed. Terminating extra container %s", containerID)
-		p.containerIDs.Delete(containerID)
-		go TerminateContainer(containerID)
+// Languages 获取各子池的语言镜像名，共享子池为空字符串
+func (p *JudgePool) Languages() []string {
+	return slices.Sorted(maps.Keys(p.pools))
+}
+
+// Initialize 预热所有子池
+// 共享子池的大小取 min_size (未配置时为 max_concurrent) 与 max_size，语言子池的大小取 pools 中的配置
+func (p *JudgePool) Initialize() {
+	if shared, ok := p.pools[""]; ok {
+		minSize := p.sandboxConfig.MinSize
+		if minSize <= 0 {
+			minSize = p.sandboxConfig.MaxConcurrent
+		}
+		shared.initialize(minSize, p.sandboxConfig.MaxSize)
+		return
+	}
+
+	for language, size := range p.sandboxConfig.Pools {
+		name, _ := ImageLanguage(language)
+		p.pools[name].initialize(max(size.MinSize, 1), size.MaxSize)
 	}
 }
 
-// Shutdown 在服务关闭时终止池中所有容器
-func (p *JudgePool) Shutdown() {
-	p.mutex.Lock()
-	close(p.pool)
-	p.mutex.Unlock()
+// AcquireContainer 从语言对应的子池中获取一个可用的空闲沙盒，池为空时最多等待 acquire_timeout
+// language 可以是语言名称或源文件扩展名，没有对应子池时返回 ErrNoPool
+// 超时、上下文取消或池关闭时返回 *AcquireError
+func (p *JudgePool) AcquireContainer(ctx context.Context, language string) (Sandbox, error) {
+	sub := p.subPool(language)
+	if sub == nil {
+		return nil, fmt.Errorf("%w %q", ErrNoPool, language)
+	}
 
-	log.Println("[FeasOJ] Shutting down container pool...")
-	p.containerIDs.Range(func(key, value interface{}) bool {
-		containerID := key.(string)
-		TerminateContainer(containerID)
-		log.Printf("[FeasOJ] Terminated container %s", containerID)
-		return true
-	})
+	ctx, cancel := context.WithTimeout(ctx, p.acquireTimeout())
+	defer cancel()
+
+	sb, err := sub.acquire(ctx)
+	if err != nil {
+		return nil, &AcquireError{Pool: sub.name(), Err: err}
+	}
+	p.owners.Store(sb.ID(), sub)
+	return sb, nil
 }
 
-// resetContainer 用于在归还容器到池中前清理所有残留的任务目录
-func (p *JudgePool) resetContainer(containerID string) error {
-	resetCmd := exec.Command("docker", "exec", containerID, "sh", "-c", "find /workspace -maxdepth 1 -type d -name 'task_*' -exec rm -rf {} +")
-	if err := resetCmd.Run(); err != nil {
-		log.Printf("[FeasOJ] Error resetting container %s: %v", containerID, err)
-		return err
+// ReleaseContainer 将沙盒归还到其所属的子池
+func (p *JudgePool) ReleaseContainer(sb Sandbox) {
+	owner, ok := p.owners.LoadAndDelete(sb.ID())
+	if !ok {
+		log.Printf("[FeasOJ] Released unknown sandbox %s, terminating it", sb.ID())
+		sb.Close()
+		return
 	}
-	return nil
+	owner.(*subPool).release(sb)
 }
 
-// startContainer 启动一个新的沙盒容器并返回其ID
-func (p *JudgePool) startContainer() (string, error) {
-	ctx := context.Background()
+// Judge 从池中取出沙盒评测指定代码，评测结束后归还沙盒，并行运行测试点时从同一子池借用空闲沙盒
+// ctx 只限制获取沙盒的等待，未能获取沙盒时返回 *AcquireError，语言没有子池时返回系统错误结果
+func (p *JudgePool) Judge(ctx context.Context, filename string, code []byte, problem *global.Problem, testCases []*global.TestCaseRequest, opts JudgeOptions) (*global.JudgeResult, error) {
+	sb, err := p.AcquireContainer(ctx, filepath.Ext(filename))
+	if errors.Is(err, ErrNoPool) {
+		log.Printf("[FeasOJ] Cannot judge %s: %v", filename, err)
+		return &global.JudgeResult{Status: global.SystemError}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer p.ReleaseContainer(sb)
+
+	opts.borrow = func(n int) []Sandbox {
+		return p.borrow(sb, n)
+	}
+	opts.giveBack = p.ReleaseContainer
+	return CompileAndRun(filename, code, sb, p.cache(sb), problem, testCases, opts), nil
+}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+// Run 从池中取出沙盒使用自定义输入运行代码，运行结束后归还沙盒
+// ctx 只限制获取沙盒的等待，错误处理与 Judge 相同
+func (p *JudgePool) Run(ctx context.Context, filename string, code []byte, problem *global.Problem, input string) (*global.RunResult, error) {
+	sb, err := p.AcquireContainer(ctx, filepath.Ext(filename))
+	if errors.Is(err, ErrNoPool) {
+		log.Printf("[FeasOJ] Cannot run %s: %v", filename, err)
+		return &global.RunResult{Status: global.SystemError}, nil
+	}
 	if err != nil {
-		return "", err
+		return nil, err
 	}
+	defer p.ReleaseContainer(sb)
+
+	return RunWithInput(filename, code, sb, p.cache(sb), problem, input), nil
+}
 
-	containerConfig := &container.Config{
-		Image: "judgecore:latest",
-		Cmd:   []string{"sh"},
-		Tty:   true,
+// AcquireStats 获取各子池的沙盒等待时间统计，以子池名称为键
+func (p *JudgePool) AcquireStats() map[string]AcquireStats {
+	stats := make(map[string]AcquireStats, len(p.pools))
+	for _, sub := range p.pools {
+		stats[sub.name()] = sub.wait.snapshot()
 	}
+	return stats
+}
 
-	hostConfig := &container.HostConfig{
-		Resources: container.Resources{
-			Memory:    p.sandboxConfig.Memory,
-			NanoCPUs:  int64(p.sandboxConfig.NanoCPUs * 1e9),
-			CPUShares: p.sandboxConfig.CPUShares,
-		},
-		Binds: []string{
-			p.codeDir + ":/workspace", // 挂载文件夹
-		},
-		AutoRemove: true, // 容器退出后自动删除
-		CapDrop:    []string{"ALL"},
+// Target 获取所有子池的目标沙盒数量之和
+func (p *JudgePool) Target() int {
+	total := 0
+	for _, sub := range p.pools {
+		total += sub.targetSize()
 	}
+	return total
+}
 
-	resp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
-	if err != nil {
-		return "", err
+// OnResize 注册目标数量之和变化时的回调，用于让 worker 数量跟随池大小
+func (p *JudgePool) OnResize(fn func(int)) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.onResize = fn
+}
+
+// Shutdown 在服务关闭时销毁所有子池中的沙盒
+func (p *JudgePool) Shutdown() {
+	close(p.done)
+	for _, sub := range p.pools {
+		sub.shutdown()
+	}
+}
+
+// borrow 不等待地从 sb 所属子池中取出至多 n 个空闲沙盒，使用后通过 ReleaseContainer 归还
+func (p *JudgePool) borrow(sb Sandbox, n int) []Sandbox {
+	owner, ok := p.owners.Load(sb.ID())
+	if !ok {
+		return nil
+	}
+	sub := owner.(*subPool)
+
+	borrowed := sub.tryAcquire(n)
+	for _, helper := range borrowed {
+		p.owners.Store(helper.ID(), sub)
 	}
+	return borrowed
+}
 
-	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
-		return "", err
+// cache 获取沙盒所属子池的编译产物缓存，未启用缓存时返回 nil
+func (p *JudgePool) cache(sb Sandbox) *compileCache {
+	owner, ok := p.owners.Load(sb.ID())
+	if !ok {
+		return nil
 	}
+	return owner.(*subPool).cache
+}
 
-	p.containerIDs.Store(resp.ID, true)
-	return resp.ID, nil
+// acquireTimeout 获取沙盒的最长等待时间
+func (p *JudgePool) acquireTimeout() time.Duration {
+	if p.sandboxConfig.AcquireTimeout > 0 {
+		return time.Duration(p.sandboxConfig.AcquireTimeout) * time.Second
+	}
+	return defaultAcquireTimeout
+}
+
+// subPool 获取语言对应的子池，存在共享子池时所有语言都使用它
+func (p *JudgePool) subPool(language string) *subPool {
+	if shared, ok := p.pools[""]; ok {
+		return shared
+	}
+	name, ok := ImageLanguage(language)
+	if !ok {
+		return nil
+	}
+	return p.pools[name]
+}
+
+// resized 子池目标数量变化后通知回调
+func (p *JudgePool) resized() {
+	p.mutex.Lock()
+	onResize := p.onResize
+	p.mutex.Unlock()
+
+	if onResize != nil {
+		onResize(p.Target())
+	}
 }
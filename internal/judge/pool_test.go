@@ -0,0 +1,117 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestPoolReplacesDeadSandbox(t *testing.T) {
+	pool, err := NewJudgePool(config.Sandbox{Backend: BackendLocal, MinSize: 1, MaxSize: 1}, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Initialize()
+	defer pool.Shutdown()
+	sub := pool.pools[""]
+
+	// 模拟沙盒失效
+	dead := acquire(t, pool, ".py")
+	os.RemoveAll(dead.(*localSandbox).dir)
+	sub.put(dead)
+
+	sb := acquire(t, pool, ".py")
+	if sb.ID() == dead.ID() {
+		t.Fatal("dead sandbox was not replaced")
+	}
+	pool.ReleaseContainer(sb)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sub.pool) != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(sub.pool) != 1 {
+		t.Errorf("pool has %d idle sandboxes, want 1", len(sub.pool))
+	}
+}
+
+func TestPoolRetiresUsedSandbox(t *testing.T) {
+	pool, err := NewJudgePool(config.Sandbox{Backend: BackendLocal, MinSize: 1, MaxSize: 1, MaxUses: 1}, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Initialize()
+	defer pool.Shutdown()
+
+	used := acquire(t, pool, ".py")
+	pool.ReleaseContainer(used)
+
+	sb := acquire(t, pool, ".py")
+	if sb.ID() == used.ID() {
+		t.Fatal("sandbox was not retired after reaching max uses")
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for used.Ping(t.Context()) == nil && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if used.Ping(t.Context()) == nil {
+		t.Error("retired sandbox was not closed")
+	}
+	pool.ReleaseContainer(sb)
+}
+
+func TestPoolRoutesByLanguage(t *testing.T) {
+	cfg := config.Sandbox{Backend: BackendLocal, Pools: map[string]config.LanguagePool{"cpp": {MinSize: 1}}}
+	pool, err := NewJudgePool(cfg, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Initialize()
+	defer pool.Shutdown()
+
+	sb := acquire(t, pool, ".cpp")
+	pool.ReleaseContainer(sb)
+	if len(pool.pools["cpp"].pool) != 1 {
+		t.Error("sandbox was not returned to the cpp pool")
+	}
+
+	if _, err := pool.AcquireContainer(t.Context(), ".py"); !errors.Is(err, ErrNoPool) {
+		t.Errorf("got %v for a language without a pool, want ErrNoPool", err)
+	}
+}
+
+func TestPoolAcquireTimeout(t *testing.T) {
+	pool, err := NewJudgePool(config.Sandbox{Backend: BackendLocal, MinSize: 1, MaxSize: 1, AcquireTimeout: 1}, "", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.Initialize()
+
+	sb := acquire(t, pool, ".py")
+	var acquireErr *AcquireError
+	if _, err := pool.AcquireContainer(t.Context(), ".py"); !errors.As(err, &acquireErr) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v while the pool is empty, want a deadline error", err)
+	}
+	pool.ReleaseContainer(sb)
+
+	pool.Shutdown()
+	if _, err := pool.AcquireContainer(t.Context(), ".py"); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("got %v after shutdown, want ErrPoolClosed", err)
+	}
+	if stats := pool.AcquireStats()[BackendLocal]; stats.Acquired != 1 || stats.Failed != 2 || stats.Waiting != 0 {
+		t.Errorf("unexpected acquire stats %+v", stats)
+	}
+}
+
+// acquire 获取沙盒，失败时终止测试
+func acquire(t *testing.T, pool *JudgePool, language string) Sandbox {
+	t.Helper()
+	sb, err := pool.AcquireContainer(t.Context(), language)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sb
+}
@@ -0,0 +1,271 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"JudgeCore/internal/global"
+	"JudgeCore/internal/utils"
+	"JudgeCore/internal/utils/sql"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"gorm.io/gorm"
+)
+
+// 重判范围
+const (
+	RejudgeScopeSubmission = "submission"
+	RejudgeScopeProblem    = "problem"
+	RejudgeScopeContest    = "contest"
+)
+
+// 重判任务状态
+const (
+	RejudgePending  = "pending"
+	RejudgeRunning  = "running"
+	RejudgeFinished = "finished"
+)
+
+// rejudgeJobHistory 查询重判任务列表时返回的最近任务数量
+const rejudgeJobHistory = 100
+
+// ErrNoSubmissions 重判范围内没有任何提交记录
+var ErrNoSubmissions = errors.New("no submissions to rejudge")
+
+// RejudgeJob 重判任务及其进度
+type RejudgeJob struct {
+	ID         string     `json:"id"`
+	Scope      string     `json:"scope"`
+	TargetID   int        `json:"target_id"`
+	Status     string     `json:"status"`
+	Total      int        `json:"total"`
+	Done       int        `json:"done"`
+	Changed    int        `json:"changed"`
+	Failed     int        `json:"failed"`
+	CreatedAt  time.Time  `json:"created_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// RejudgeManager 创建重判任务并将每条提交记录作为重判任务投递到判题任务队列
+// 任务由 worker 按提交ID评测，进度由重判记录统计，重启或多实例部署时仍可查询
+type RejudgeManager struct {
+	rmqConfig config.RabbitMQ
+	db        *gorm.DB
+	mutex     sync.Mutex
+	conn      *amqp.Connection
+	ch        *amqp.Channel
+}
+
+// NewRejudgeManager 创建一个新的 RejudgeManager 实例
+func NewRejudgeManager(rmqConfig config.RabbitMQ, db *gorm.DB) *RejudgeManager {
+	return &RejudgeManager{
+		rmqConfig: rmqConfig,
+		db:        db,
+	}
+}
+
+// Submit 按范围创建重判任务并投递到判题任务队列，返回任务快照
+func (m *RejudgeManager) Submit(scope string, targetID int) (RejudgeJob, error) {
+	var records []*global.SubmitRecord
+	var err error
+
+	switch scope {
+	case RejudgeScopeSubmission:
+		var record *global.SubmitRecord
+		record, err = sql.SelectSubmitRecordBySid(m.db, targetID)
+		if record != nil {
+			records = append(records, record)
+		}
+	case RejudgeScopeProblem:
+		records, err = sql.SelectSubmitRecordsByPid(m.db, targetID)
+	case RejudgeScopeContest:
+		records, err = sql.SelectSubmitRecordsByContestID(m.db, targetID)
+	default:
+		return RejudgeJob{}, fmt.Errorf("unknown rejudge scope: %s", scope)
+	}
+	if err != nil {
+		return RejudgeJob{}, err
+	}
+	if len(records) == 0 {
+		return RejudgeJob{}, ErrNoSubmissions
+	}
+
+	job := &global.RejudgeJob{
+		ID:        fmt.Sprintf("%d-%s", time.Now().Unix(), strings.ToLower(rand.Text()[:8])),
+		Scope:     scope,
+		TargetID:  targetID,
+		Total:     len(records),
+		CreatedAt: time.Now(),
+	}
+	if err := sql.InsertRejudgeJob(m.db, job); err != nil {
+		return RejudgeJob{}, err
+	}
+
+	queued, err := m.publish(job.ID, records)
+	if err != nil {
+		// 未投递的提交记录不计入任务，已投递的照常重判
+		log.Printf("[FeasOJ] Rejudge job %s queued %d of %d submissions: %v", job.ID, queued, len(records), err)
+		job.Total = queued
+		if err := sql.ModifyRejudgeJobTotal(m.db, job.ID, queued); err != nil {
+			log.Printf("[FeasOJ] Failed to update rejudge job %s: %v", job.ID, err)
+		}
+		if queued == 0 {
+			return RejudgeJob{}, err
+		}
+	}
+
+	log.Printf("[FeasOJ] Rejudge job %s created: %s %d, %d submissions", job.ID, scope, targetID, job.Total)
+	return m.snapshot(job)
+}
+
+// Job 获取指定重判任务的快照，任务不存在时返回 gorm.ErrRecordNotFound
+func (m *RejudgeManager) Job(id string) (RejudgeJob, error) {
+	job, err := sql.SelectRejudgeJob(m.db, id)
+	if err != nil {
+		return RejudgeJob{}, err
+	}
+	return m.snapshot(job)
+}
+
+// Jobs 获取最近创建的重判任务的快照
+func (m *RejudgeManager) Jobs() ([]RejudgeJob, error) {
+	jobs, err := sql.SelectRecentRejudgeJobs(m.db, rejudgeJobHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots := make([]RejudgeJob, 0, len(jobs))
+	for _, job := range jobs {
+		snapshot, err := m.snapshot(job)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+// snapshot 根据重判记录统计任务进度
+func (m *RejudgeManager) snapshot(job *global.RejudgeJob) (RejudgeJob, error) {
+	progress, err := sql.SelectRejudgeProgress(m.db, job.ID)
+	if err != nil {
+		return RejudgeJob{}, err
+	}
+
+	snapshot := RejudgeJob{
+		ID:        job.ID,
+		Scope:     job.Scope,
+		TargetID:  job.TargetID,
+		Status:    RejudgePending,
+		Total:     job.Total,
+		Done:      progress.Done,
+		Changed:   progress.Changed,
+		Failed:    progress.Failed,
+		CreatedAt: job.CreatedAt,
+	}
+	switch {
+	case progress.Done >= job.Total:
+		snapshot.Status = RejudgeFinished
+		snapshot.FinishedAt = progress.LastDone
+	case progress.Done > 0:
+		snapshot.Status = RejudgeRunning
+	}
+	return snapshot, nil
+}
+
+// publish 将提交记录逐条投递到判题任务队列，返回成功投递的数量
+func (m *RejudgeManager) publish(jobID string, records []*global.SubmitRecord) (int, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ch == nil || m.ch.IsClosed() {
+		m.close()
+		conn, ch, err := utils.ConnectRabbitMQ(m.rmqConfig)
+		if err != nil {
+			return 0, err
+		}
+		m.conn, m.ch = conn, ch
+	}
+
+	for i, record := range records {
+		err := utils.PublishTask(m.ch, global.TaskMessage{
+			Type:         global.TaskTypeRejudge,
+			UserID:       record.Uid,
+			ProblemID:    record.Pid,
+			SubmissionID: record.Sid,
+			RejudgeJobID: jobID,
+		})
+		if err != nil {
+			m.close()
+			return i, err
+		}
+	}
+	return len(records), nil
+}
+
+// close 关闭投递使用的连接，下次投递时重新连接
+func (m *RejudgeManager) close() {
+	if m.conn != nil {
+		m.conn.Close()
+	}
+	m.conn, m.ch = nil, nil
+}
+
+// rejudgeTask 重判任务中的一条提交记录，按提交ID更新结果并写入重判记录
+// 重判期间不修改提交记录的状态，未能获取沙盒或排空超时时返回错误使任务重新入队
+func rejudgeTask(task Task, abort <-chan struct{}, db *gorm.DB, pool *JudgePool) error {
+	audit := &global.RejudgeRecord{
+		JobID: task.JobID,
+		Sid:   task.SID,
+		Pid:   task.PID,
+		Uid:   task.UID,
+	}
+
+	record, err := sql.SelectSubmitRecordBySid(db, task.SID)
+	if err == nil {
+		audit.OldResult = record.Result
+		audit.NewResult, err = rejudgeRecord(record, abort, db, pool)
+		var acquireErr *AcquireError
+		if errors.As(err, &acquireErr) || errors.Is(err, errDrainAborted) {
+			return err
+		}
+	}
+	if err != nil {
+		// 记录为失败，使任务仍能完成
+		log.Printf("[FeasOJ] Rejudge job %s failed on SID %d: %v", task.JobID, task.SID, err)
+	}
+
+	audit.CreatedAt = time.Now()
+	if err := sql.InsertRejudgeRecord(db, audit); err != nil {
+		log.Printf("[FeasOJ] Failed to write rejudge record for SID %d: %v", task.SID, err)
+	}
+	return nil
+}
+
+// rejudgeRecord 评测提交记录中保存的代码并按提交ID更新结果，返回新结果
+func rejudgeRecord(record *global.SubmitRecord, abort <-chan struct{}, db *gorm.DB, pool *JudgePool) (string, error) {
+	ext, ok := LanguageExt(record.Language)
+	if !ok {
+		return "", fmt.Errorf("unsupported language: %s", record.Language)
+	}
+
+	filename := SourceName(fmt.Sprintf("rejudge_%d", record.Sid), ext)
+	result, err := judgeSource(db, pool, record.Pid, filename, []byte(record.Code), "")
+	if aborted(abort) {
+		// 沙盒可能已被销毁，结果不可信
+		return "", errDrainAborted
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if err := sql.ModifySubmitResultBySid(db, record.Sid, result.Status); err != nil {
+		return "", err
+	}
+	return result.Status, nil
+}
@@ -0,0 +1,100 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// compileError 编译器以非零状态退出或编译超时，由提交的代码导致
+type compileError struct {
+	exitCode int // 编译超时时为 -1
+}
+
+func (e *compileError) Error() string {
+	if e.exitCode < 0 {
+		return "compilation timed out"
+	}
+	return fmt.Sprintf("compiler exited with code %d", e.exitCode)
+}
+
+// compileResult 将编译命令的执行结果转换为 Compile 的返回值，执行失败且未超时时原样返回错误
+func compileResult(ctx context.Context, output string, exitCode int, err error) (string, error) {
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return output, &compileError{exitCode: -1}
+		}
+		return output, err
+	}
+	if exitCode != 0 {
+		return output, &compileError{exitCode: exitCode}
+	}
+	return output, nil
+}
+
+// 沙盒后端类型
+const (
+	BackendDocker = "docker"
+	BackendLocal  = "local"
+	BackendJail   = "jail"
+)
+
+// Limits 单次运行的资源限制
+type Limits struct {
+	TimeLimit   int // 时间限制 (秒)
+	MemoryLimit int // 内存限制 (KB)
+}
+
+// Sandbox 评测沙盒实例，同一时间只服务一个任务
+type Sandbox interface {
+	// ID 沙盒实例标识
+	ID() string
+	// Prepare 创建任务目录并写入代码
+	Prepare(ctx context.Context, filename string, code []byte) error
+	// Compile 编译当前任务的代码，返回编译输出
+	// 编译器以非零状态退出或编译超时时返回 *compileError，其余错误表示沙盒故障
+	Compile(ctx context.Context) (string, error)
+	// SaveArtifact 将编译后的任务目录打包为 tar 归档，用于缓存编译产物
+	SaveArtifact(ctx context.Context) ([]byte, error)
+	// LoadArtifact 将缓存的编译产物解包到当前任务目录，代替编译
+	LoadArtifact(ctx context.Context, artifact []byte) error
+	// Run 使用给定输入运行已编译的程序，上下文超时表示超出时间限制
+	Run(ctx context.Context, stdin io.Reader, limits Limits) (*ExecResult, RunStat, error)
+	// Exec 在沙盒内执行任意脚本，用于自检与维护
+	Exec(ctx context.Context, script string, stdin io.Reader) (*ExecResult, error)
+	// Ping 检查沙盒是否仍然可用
+	Ping(ctx context.Context) error
+	// Cleanup 清理当前任务及其残留，失败时沙盒不应再被复用
+	Cleanup(ctx context.Context) error
+	// Close 销毁沙盒实例
+	Close() error
+}
+
+// Backend 沙盒后端，负责创建沙盒实例
+type Backend interface {
+	// Name 后端名称
+	Name() string
+	// Setup 准备创建指定语言沙盒所需的资源，如 Docker 镜像
+	Setup(ctx context.Context, language string) error
+	// Create 创建一个用于指定语言的沙盒实例，language 为空表示支持所有语言
+	Create(ctx context.Context, language string) (Sandbox, error)
+	// NetworkIsolated 沙盒内程序是否无法访问网络
+	NetworkIsolated() bool
+}
+
+// NewBackend 根据配置创建沙盒后端，未配置时使用 Docker
+// serviceID 为服务在 Consul 中的ID，Docker 后端用它识别上次运行遗留的容器
+func NewBackend(sandboxConfig config.Sandbox, serviceID string) (Backend, error) {
+	switch sandboxConfig.Backend {
+	case "", BackendDocker:
+		return newDockerBackend(sandboxConfig, serviceID)
+	case BackendLocal:
+		return newLocalBackend(sandboxConfig)
+	case BackendJail:
+		return newJailBackend(sandboxConfig)
+	default:
+		return nil, fmt.Errorf("unknown sandbox backend: %s", sandboxConfig.Backend)
+	}
+}
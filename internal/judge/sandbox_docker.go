@@ -0,0 +1,441 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"bytes"
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	cerrdefs "github.com/containerd/errdefs"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// seccompProfile 内置的 seccomp 配置，基于 Docker 默认的白名单配置，并以终止进程的方式拦截 ptrace、mount、keyctl 等危险系统调用
+//
+//go:embed seccomp.json
+var seccompProfile []byte
+
+// killStrayTrap 脚本退出时终止其启动的所有后台进程
+// kill -1 作用于当前用户在容器内可见的全部进程，但不包括 PID 1 与调用者自身
+const killStrayTrap = "trap 'kill -9 -1 2>/dev/null' EXIT; "
+
+// maxZombies 容器内允许累积的僵尸进程数，超出后容器被替换以免耗尽进程数限制
+const maxZombies = 16
+
+// reapScript 终止容器内除 PID 1 外的所有进程，并确认没有残留的存活进程
+// PID 1 的 sh 不会回收孤儿进程，僵尸进程不占用 CPU，只限制其数量
+var reapScript = fmt.Sprintf(`kill -9 -1 2>/dev/null
+for i in 1 2 3 4 5; do
+	stray=""; zombies=0
+	for p in /proc/[0-9]*; do
+		pid=${p#/proc/}
+		[ "$pid" = 1 ] || [ "$pid" = $$ ] && continue
+		state=$(sed 's/.*) //' $p/stat 2>/dev/null | cut -c1)
+		case "$state" in
+			"") ;;
+			Z) zombies=$((zombies+1)) ;;
+			*) stray="$stray $pid" ;;
+		esac
+	done
+	[ -z "$stray" ] && break
+	kill -9 -1 2>/dev/null; sleep 0.1
+done
+[ -z "$stray" ] || { echo "stray processes:$stray" >&2; exit 1; }
+[ $zombies -le %d ] || { echo "$zombies zombie processes" >&2; exit 1; }`, maxZombies)
+
+// 沙盒容器的标签，用于在重启后找到上次运行遗留的容器
+const (
+	labelService  = "judgecore.service"  // 服务在 Consul 中的ID
+	labelInstance = "judgecore.instance" // 创建容器的进程实例ID，每次启动随机生成
+)
+
+// DockerBackend 基于 Docker 容器的沙盒后端
+type DockerBackend struct {
+	config     config.Sandbox
+	dockerfile []byte // 沙盒镜像的 Dockerfile 内容
+	serviceID  string
+	instanceID string
+}
+
+// dockerSandbox 常驻的沙盒容器，任务在 /workspace 下的独立目录中执行
+type dockerSandbox struct {
+	containerID string
+	taskDir     string
+	filename    string
+}
+
+// newDockerBackend 创建 Docker 后端，清理同一服务上次运行遗留的容器，配置了运行时则确认其已在 Docker 中注册
+func newDockerBackend(sandboxConfig config.Sandbox, serviceID string) (Backend, error) {
+	backend := &DockerBackend{
+		config:     sandboxConfig,
+		dockerfile: sandboxDockerfile,
+		serviceID:  serviceID,
+		instanceID: rand.Text(),
+	}
+	if sandboxConfig.Dockerfile != "" {
+		dockerfile, err := os.ReadFile(sandboxConfig.Dockerfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sandbox Dockerfile: %w", err)
+		}
+		backend.dockerfile = dockerfile
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	// 进程崩溃后容器不会被停止，AutoRemove 也就不会生效
+	if err := backend.reclaimOrphans(ctx); err != nil {
+		log.Printf("[FeasOJ] Failed to reclaim orphaned sandbox containers: %v", err)
+	}
+
+	if sandboxConfig.Runtime == "" {
+		return backend, nil
+	}
+	if err := verifyRuntime(ctx, sandboxConfig.Runtime); err != nil {
+		return nil, err
+	}
+	log.Printf("[FeasOJ] Sandbox containers will run with runtime %s", sandboxConfig.Runtime)
+	return backend, nil
+}
+
+// reclaimOrphans 强制删除同一服务ID下其他实例创建的沙盒容器
+func (b *DockerBackend) reclaimOrphans(ctx context.Context) error {
+	cli, err := DockerClient()
+	if err != nil {
+		return err
+	}
+
+	containers, err := cli.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", labelService+"="+b.serviceID)),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, c := range containers {
+		if c.Labels[labelInstance] == b.instanceID {
+			continue
+		}
+		if err := cli.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}); err != nil {
+			log.Printf("[FeasOJ] Error removing orphaned container %s: %v", c.ID, err)
+			continue
+		}
+		log.Printf("[FeasOJ] Removed orphaned sandbox container %s from instance %s", c.ID, c.Labels[labelInstance])
+	}
+	return nil
+}
+
+// verifyRuntime 确认 Docker 守护进程已注册指定的 OCI 运行时
+func verifyRuntime(ctx context.Context, runtime string) error {
+	cli, err := DockerClient()
+	if err != nil {
+		return err
+	}
+
+	info, err := cli.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query Docker runtimes: %w", err)
+	}
+	if _, ok := info.Runtimes[runtime]; ok {
+		return nil
+	}
+
+	available := slices.Sorted(maps.Keys(info.Runtimes))
+	return fmt.Errorf("sandbox runtime %q is not registered with Docker (available: %s), install it and add it to daemon.json or clear sandbox.runtime to use %s",
+		runtime, strings.Join(available, ", "), info.DefaultRuntime)
+}
+
+func (b *DockerBackend) Name() string {
+	return BackendDocker
+}
+
+// Setup 确保语言镜像存在，已存在时跳过，配置了镜像仓库时拉取预构建的镜像，否则在本地构建
+func (b *DockerBackend) Setup(ctx context.Context, language string) error {
+	cli, err := DockerClient()
+	if err != nil {
+		return err
+	}
+
+	ref := b.image(language)
+	if _, err := cli.ImageInspect(ctx, ref); err == nil {
+		log.Printf("[FeasOJ] SandBox %s already exists, skipping build", ref)
+		return nil
+	} else if !cerrdefs.IsNotFound(err) {
+		return err
+	}
+
+	if b.config.Registry != "" {
+		return pullImage(ctx, ref)
+	}
+	return buildImage(ctx, ref, b.dockerfile, imagePackages(language))
+}
+
+func (b *DockerBackend) NetworkIsolated() bool {
+	return b.networkMode() == "none"
+}
+
+// Create 使用语言对应的镜像启动一个新的沙盒容器
+func (b *DockerBackend) Create(ctx context.Context, language string) (Sandbox, error) {
+	containerID, err := b.startContainer(ctx, b.image(language))
+	if err != nil {
+		return nil, err
+	}
+	return &dockerSandbox{containerID: containerID}, nil
+}
+
+// image 获取语言沙盒镜像的引用
+func (b *DockerBackend) image(language string) string {
+	return imageRef(b.config.Registry, b.dockerfile, language)
+}
+
+// networkMode 获取容器网络模式，未配置时禁用网络
+func (b *DockerBackend) networkMode() string {
+	if b.config.NetworkMode == "" {
+		return "none"
+	}
+	return b.config.NetworkMode
+}
+
+// user 获取编译与运行代码的用户，未配置时使用 nobody
+func (b *DockerBackend) user() string {
+	if b.config.User == "" {
+		return "65534:65534"
+	}
+	return b.config.User
+}
+
+// tmpfsOptions 生成工作目录 tmpfs 挂载参数，需允许执行编译产物
+func (b *DockerBackend) tmpfsOptions() string {
+	options := "rw,exec,nosuid,nodev,mode=1777"
+	if b.config.WorkDirSize != "" {
+		options += ",size=" + b.config.WorkDirSize
+	}
+	return options
+}
+
+// seccompOption 生成 seccomp 安全选项，Docker API 需要传入配置文件内容而非路径
+func (b *DockerBackend) seccompOption() (string, error) {
+	switch b.config.Seccomp {
+	case "":
+		return "seccomp=" + string(seccompProfile), nil
+	case "unconfined":
+		return "seccomp=unconfined", nil
+	}
+
+	profile, err := os.ReadFile(b.config.Seccomp)
+	if err != nil {
+		return "", fmt.Errorf("failed to read seccomp profile: %w", err)
+	}
+	return "seccomp=" + string(profile), nil
+}
+
+// startContainer 使用指定镜像启动一个新的沙盒容器并返回其ID
+func (b *DockerBackend) startContainer(ctx context.Context, image string) (string, error) {
+	cli, err := DockerClient()
+	if err != nil {
+		return "", err
+	}
+
+	containerConfig := &container.Config{
+		Image: image,
+		Cmd:   []string{"sh"},
+		Tty:   true,
+		User:  b.user(), // docker exec 默认沿用该用户
+		Labels: map[string]string{
+			labelService:  b.serviceID,
+			labelInstance: b.instanceID,
+		},
+	}
+
+	hostConfig := &container.HostConfig{
+		Resources: container.Resources{
+			Memory:    b.config.Memory,
+			NanoCPUs:  int64(b.config.NanoCPUs * 1e9),
+			CPUShares: b.config.CPUShares,
+		},
+		Tmpfs: map[string]string{
+			"/workspace": b.tmpfsOptions(),
+			"/tmp":       b.tmpfsOptions(),
+		},
+		ReadonlyRootfs: b.config.ReadonlyRoot,
+		Runtime:        b.config.Runtime, // 留空使用 Docker 默认运行时
+		NetworkMode:    container.NetworkMode(b.networkMode()),
+		AutoRemove:     true, // 容器退出后自动删除
+		CapDrop:        []string{"ALL"},
+	}
+	if b.config.NoNewPrivs {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges")
+	}
+	// 进程数只通过容器的 pids cgroup 限制，RLIMIT_NPROC 按宿主机 UID 统计，所有沙盒共用同一个 UID 时会相互影响
+	if b.config.PidsLimit > 0 {
+		hostConfig.PidsLimit = &b.config.PidsLimit
+	}
+
+	seccompOpt, err := b.seccompOption()
+	if err != nil {
+		return "", err
+	}
+	hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, seccompOpt)
+
+	resp, err := cli.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, "")
+	if err != nil {
+		return "", err
+	}
+
+	if err := cli.ContainerStart(ctx, resp.ID, container.StartOptions{}); err != nil {
+		return "", err
+	}
+
+	return resp.ID, nil
+}
+
+func (s *dockerSandbox) ID() string {
+	return s.containerID
+}
+
+// Prepare 在容器内创建任务目录，并通过 exec 的标准输入写入代码
+// 只读根文件系统下 CopyToContainer 无法写入 tmpfs，因此不使用归档接口
+func (s *dockerSandbox) Prepare(ctx context.Context, filename string, code []byte) error {
+	taskDir := fmt.Sprintf("/workspace/task_%d", time.Now().UnixNano())
+
+	// 任务目录仅对沙盒用户可见
+	script := fmt.Sprintf("mkdir -m 700 %s && cat > %s/%s", taskDir, taskDir, filename)
+	res, err := execInContainer(ctx, s.containerID, script, bytes.NewReader(code))
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("failed to write code into %s: %s", taskDir, strings.TrimSpace(string(res.Stderr)))
+	}
+
+	s.taskDir = taskDir
+	s.filename = filename
+	return nil
+}
+
+// Compile 编译任务目录中的代码，编译失败时返回编译输出
+// 编译命令在容器内受 timeout 限制，超时后连同编译器启动的子进程一起被终止，不会在沙盒归还后继续占用 CPU
+func (s *dockerSandbox) Compile(ctx context.Context) (string, error) {
+	script := compileScript(filepath.Ext(s.filename), s.filename, s.taskDir)
+	if script == "" {
+		return "", nil
+	}
+
+	limit := compileTimeout
+	if deadline, ok := ctx.Deadline(); ok {
+		limit = time.Until(deadline)
+	}
+	// 编译脚本作为位置参数传入，无需转义
+	wrapped := killStrayTrap + fmt.Sprintf(`timeout -s SIGKILL %ds sh -c "$1"`, max(int(limit.Seconds()), 1))
+
+	output := &limitedBuffer{limit: maxOutputSize}
+	exitCode, err := dockerExec(ctx, s.containerID, []string{"sh", "-c", wrapped, "sh", script}, nil, output, output)
+	return compileResult(ctx, output.String(), exitCode, err)
+}
+
+// SaveArtifact 使用容器内的 tar 打包任务目录
+func (s *dockerSandbox) SaveArtifact(ctx context.Context) ([]byte, error) {
+	res, err := execInContainer(ctx, s.containerID, fmt.Sprintf("tar -C %s -cf - .", s.taskDir), nil)
+	if err != nil {
+		return nil, err
+	}
+	if res.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to archive %s: %s", s.taskDir, strings.TrimSpace(string(res.Stderr)))
+	}
+	if len(res.Stdout) >= maxOutputSize {
+		return nil, fmt.Errorf("artifact of %s is too large", s.taskDir)
+	}
+	return res.Stdout, nil
+}
+
+// LoadArtifact 通过 exec 的标准输入将归档解包到任务目录
+func (s *dockerSandbox) LoadArtifact(ctx context.Context, artifact []byte) error {
+	script := fmt.Sprintf("tar -C %s -xf -", s.taskDir)
+	res, err := execInContainer(ctx, s.containerID, script, bytes.NewReader(artifact))
+	if err != nil {
+		return err
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("failed to extract artifact into %s: %s", s.taskDir, strings.TrimSpace(string(res.Stderr)))
+	}
+	return nil
+}
+
+// Run 使用给定输入运行已编译的程序，由容器内的 time 统计耗时与内存
+// 统计基于容器内的 wait4，不依赖宿主机 cgroup 记账，因此在 runsc、kata 等运行时下同样有效
+func (s *dockerSandbox) Run(ctx context.Context, stdin io.Reader, limits Limits) (*ExecResult, RunStat, error) {
+	cmdStr := buildRunCommand(filepath.Ext(s.filename), s.filename, s.taskDir, limits.MemoryLimit)
+	if cmdStr == "" {
+		return nil, RunStat{}, fmt.Errorf("unsupported source file: %s", s.filename)
+	}
+
+	// 程序留在后台的进程会占用下一个测试点的 CPU，并使输出流无法结束
+	script := killStrayTrap + wrapRunCommand(cmdStr, s.taskDir, limits.TimeLimit, limits.MemoryLimit)
+	res, err := execInContainer(ctx, s.containerID, script, stdin)
+	if err != nil {
+		return res, RunStat{}, err
+	}
+
+	var stat RunStat
+	res.Stderr, stat = extractStat(res.Stderr)
+	return res, stat, nil
+}
+
+func (s *dockerSandbox) Exec(ctx context.Context, script string, stdin io.Reader) (*ExecResult, error) {
+	return execInContainer(ctx, s.containerID, script, stdin)
+}
+
+// Ping 在容器内执行空命令，容器已退出或 Docker 守护进程不可用时返回错误
+func (s *dockerSandbox) Ping(ctx context.Context) error {
+	return execScript(ctx, s.containerID, "true")
+}
+
+// Cleanup 终止容器中残留的进程，并清理所有任务目录与临时文件
+func (s *dockerSandbox) Cleanup(ctx context.Context) error {
+	s.taskDir = ""
+	s.filename = ""
+
+	if err := execScript(ctx, s.containerID, reapScript); err != nil {
+		log.Printf("[FeasOJ] Error killing leftover processes in container %s: %v", s.containerID, err)
+		return err
+	}
+
+	script := "find /workspace -maxdepth 1 -type d -name 'task_*' -exec rm -rf {} + && find /tmp -mindepth 1 -delete"
+	if err := execScript(ctx, s.containerID, script); err != nil {
+		log.Printf("[FeasOJ] Error resetting container %s: %v", s.containerID, err)
+		return err
+	}
+	return nil
+}
+
+func (s *dockerSandbox) Close() error {
+	TerminateContainer(s.containerID)
+	return nil
+}
+
+// TerminateContainer 终止并删除Docker容器
+func TerminateContainer(containerID string) {
+	ctx := context.Background()
+
+	cli, err := DockerClient()
+	if err != nil {
+		log.Printf("[FeasOJ] Error creating Docker client for termination: %v", err)
+		return
+	}
+
+	if err := cli.ContainerStop(ctx, containerID, container.StopOptions{}); err != nil {
+		log.Printf("[FeasOJ] Error stopping container %s: %v", containerID, err)
+	}
+}
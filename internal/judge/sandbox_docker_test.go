@@ -0,0 +1,47 @@
+package judge
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestSeccompProfile(t *testing.T) {
+	var profile struct {
+		DefaultAction string `json:"defaultAction"`
+		Syscalls      []struct {
+			Names  []string `json:"names"`
+			Action string   `json:"action"`
+		} `json:"syscalls"`
+	}
+	if err := json.Unmarshal(seccompProfile, &profile); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未列出的系统调用默认被拒绝
+	if profile.DefaultAction != "SCMP_ACT_ERRNO" {
+		t.Fatalf("default action %s", profile.DefaultAction)
+	}
+
+	var denied []string
+	for _, rule := range profile.Syscalls {
+		if rule.Action == "SCMP_ACT_KILL_PROCESS" {
+			denied = append(denied, rule.Names...)
+		}
+	}
+	for _, name := range []string{"ptrace", "mount", "keyctl", "bpf", "unshare", "setns", "perf_event_open"} {
+		if !slices.Contains(denied, name) {
+			t.Errorf("%s is not killed", name)
+		}
+	}
+	for _, rule := range profile.Syscalls {
+		if rule.Action != "SCMP_ACT_ALLOW" {
+			continue
+		}
+		for _, name := range rule.Names {
+			if slices.Contains(denied, name) {
+				t.Errorf("%s is both allowed and killed", name)
+			}
+		}
+	}
+}
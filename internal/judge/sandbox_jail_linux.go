@@ -0,0 +1,386 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// defaultCgroupRoot 未配置时用于创建运行 cgroup 的父 cgroup
+const defaultCgroupRoot = "/sys/fs/cgroup/judgecore"
+
+// jailReadonlyPaths 以只读方式挂载进 jail 的系统目录，不存在时跳过
+// 安装在其他位置的工具链通过 jail_binds 追加
+var jailReadonlyPaths = []string{"/usr", "/bin", "/sbin", "/lib", "/lib32", "/lib64", "/etc"}
+
+// jailSeccompFD 传给 bubblewrap 的 seccomp 过滤器所在的文件描述符，即 ExtraFiles 的第一个
+const jailSeccompFD = 3
+
+// jailMaskedPaths 在 jail 中以空文件覆盖的敏感文件
+var jailMaskedPaths = []string{"/etc/shadow", "/etc/gshadow"}
+
+// JailBackend 使用 bubblewrap 为每次编译与运行创建全新的命名空间，并通过 cgroup v2 限制资源
+// 沙盒本身只是宿主机上的任务目录，创建开销远小于 Docker 容器
+type JailBackend struct {
+	config     config.Sandbox
+	bwrap      string
+	cgroupRoot string
+	seccomp    []byte // 编译好的 seccomp BPF 程序，为空时不安装过滤器
+	toolchain  string // Setup 时记录的宿主机编译器版本
+}
+
+// jailSandbox 复用本地沙盒的任务目录管理，所有命令都在 jail 中执行
+type jailSandbox struct {
+	localSandbox
+	backend *JailBackend
+}
+
+func newJailBackend(sandboxConfig config.Sandbox) (Backend, error) {
+	bwrap, err := exec.LookPath(cmp.Or(sandboxConfig.JailPath, "bwrap"))
+	if err != nil {
+		return nil, fmt.Errorf("bubblewrap is not available: %w", err)
+	}
+
+	cgroupRoot := cmp.Or(sandboxConfig.CgroupRoot, defaultCgroupRoot)
+	if err := os.MkdirAll(cgroupRoot, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cgroup %s: %w", cgroupRoot, err)
+	}
+	// 子 cgroup 需要父 cgroup 启用对应的控制器
+	if err := os.WriteFile(filepath.Join(cgroupRoot, "cgroup.subtree_control"), []byte("+memory +pids +cpu"), 0644); err != nil {
+		return nil, fmt.Errorf("failed to enable cgroup controllers in %s, make sure cgroup v2 is mounted and delegated to JudgeCore: %w", cgroupRoot, err)
+	}
+
+	seccomp, err := jailSeccompFilter(seccompProfile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build seccomp filter: %w", err)
+	}
+	if seccomp == nil {
+		log.Printf("[FeasOJ] Seccomp filter is not supported on %s, the jail sandbox runs without it", runtime.GOARCH)
+	}
+
+	return &JailBackend{config: sandboxConfig, bwrap: bwrap, cgroupRoot: cgroupRoot, seccomp: seccomp}, nil
+}
+
+func (b *JailBackend) Name() string {
+	return BackendJail
+}
+
+// Setup jail 后端只读挂载宿主机上的工具链，只记录编译器版本
+func (b *JailBackend) Setup(ctx context.Context, language string) error {
+	if b.toolchain == "" {
+		b.toolchain = hostToolchain(ctx)
+	}
+	return nil
+}
+
+func (b *JailBackend) toolchainVersion() string {
+	return b.toolchain
+}
+
+// NetworkIsolated jail 总是创建独立的网络命名空间
+func (b *JailBackend) NetworkIsolated() bool {
+	return true
+}
+
+// Create 在系统临时目录中创建一个新的沙盒目录，工具链来自宿主机，与语言无关
+func (b *JailBackend) Create(ctx context.Context, language string) (Sandbox, error) {
+	dir, err := os.MkdirTemp("", "judgecore-jail-")
+	if err != nil {
+		return nil, err
+	}
+	return &jailSandbox{localSandbox: localSandbox{dir: dir}, backend: b}, nil
+}
+
+// Compile 在 jail 中编译任务目录中的代码，内存受沙盒内存限制约束
+func (s *jailSandbox) Compile(ctx context.Context) (string, error) {
+	script := compileScript(filepath.Ext(s.filename), s.filename, s.taskDir)
+	if script == "" {
+		return "", nil
+	}
+
+	output := &limitedBuffer{limit: maxOutputSize}
+	exitCode, _, err := s.jail(ctx, script, nil, output, output, int(s.backend.config.Memory/1024))
+	return compileResult(ctx, output.String(), exitCode, err)
+}
+
+// Run 在全新的 jail 中运行已编译的程序，内存峰值与 OOM 由 cgroup 统计
+func (s *jailSandbox) Run(ctx context.Context, stdin io.Reader, limits Limits) (*ExecResult, RunStat, error) {
+	cmdStr := buildRunCommand(filepath.Ext(s.filename), s.filename, s.taskDir, limits.MemoryLimit)
+	if cmdStr == "" {
+		return nil, RunStat{}, fmt.Errorf("unsupported source file: %s", s.filename)
+	}
+
+	// 内存由 cgroup 按实际占用限制，不再使用 ulimit -v
+	script := localRunScript(cmdStr, s.taskDir, 0)
+	return runWithDeadline(ctx, limits, func(ctx context.Context, stdout, stderr io.Writer) (int, RunStat, error) {
+		return s.jail(ctx, script, stdin, stdout, stderr, limits.MemoryLimit)
+	})
+}
+
+func (s *jailSandbox) Exec(ctx context.Context, script string, stdin io.Reader) (*ExecResult, error) {
+	stdout := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: maxOutputSize}
+
+	exitCode, _, err := s.jail(ctx, script, stdin, stdout, stderr, 0)
+	return &ExecResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: exitCode}, err
+}
+
+// jail 在新的 cgroup 与命名空间中执行脚本，返回退出码与内存峰值，memoryLimit 为 0 时不限制内存
+// 触发 OOM 时内存峰值至少记为限制值，与 Docker 后端的判定保持一致
+func (s *jailSandbox) jail(ctx context.Context, script string, stdin io.Reader, stdout, stderr io.Writer, memoryLimit int) (int, RunStat, error) {
+	cgroup, err := s.backend.createCgroup(memoryLimit)
+	if err != nil {
+		return -1, RunStat{}, err
+	}
+	defer removeCgroup(cgroup)
+
+	cgroupDir, err := os.Open(cgroup)
+	if err != nil {
+		return -1, RunStat{}, err
+	}
+	defer cgroupDir.Close()
+
+	cmd := exec.CommandContext(ctx, s.backend.bwrap, append(s.backend.bwrapArgs(s.dir), "sh", "-c", script)...)
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:     true,
+		Pdeathsig:   syscall.SIGKILL,
+		UseCgroupFD: true,
+		CgroupFD:    int(cgroupDir.Fd()),
+	}
+	cmd.Cancel = func() error {
+		return killCgroup(cgroup)
+	}
+	if len(s.backend.seccomp) > 0 {
+		filter, err := pipeBytes(s.backend.seccomp)
+		if err != nil {
+			return -1, RunStat{}, err
+		}
+		defer filter.Close()
+		cmd.ExtraFiles = []*os.File{filter}
+	}
+
+	exitCode, _, err := runCommand(ctx, cmd)
+	// 终止程序遗留的后台进程，之后才能删除 cgroup
+	killCgroup(cgroup)
+
+	var stat RunStat
+	stat.MemoryKB, _ = readCgroupInt(filepath.Join(cgroup, "memory.peak"))
+	stat.MemoryKB /= 1024
+	if memoryLimit > 0 && cgroupOOMKilled(cgroup) {
+		stat.MemoryKB = max(stat.MemoryKB, int64(memoryLimit))
+	}
+	return exitCode, stat, err
+}
+
+// bwrapArgs 生成 bubblewrap 参数：只读系统目录、独立的 /proc /dev /tmp，仅沙盒目录可写
+func (b *JailBackend) bwrapArgs(dir string) []string {
+	args := []string{
+		"--unshare-all", "--die-with-parent", "--new-session", "--clearenv",
+		"--setenv", "PATH", os.Getenv("PATH"),
+		"--setenv", "LANG", "C.UTF-8",
+	}
+	for _, path := range slices.Concat(jailReadonlyPaths, b.config.JailBinds) {
+		args = append(args, "--ro-bind-try", path, path)
+	}
+	for _, path := range jailMaskedPaths {
+		args = append(args, "--ro-bind-try", "/dev/null", path)
+	}
+	if len(b.seccomp) > 0 {
+		args = append(args, "--seccomp", strconv.Itoa(jailSeccompFD))
+	}
+	return append(args,
+		"--proc", "/proc",
+		"--dev", "/dev",
+		"--tmpfs", "/tmp",
+		"--bind", dir, dir,
+		"--chdir", dir,
+		"--",
+	)
+}
+
+// pipeBytes 返回一个可以读出 data 的管道，data 需小于管道缓冲区
+func pipeBytes(data []byte) (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(data)
+	w.Close()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// deniedSyscalls 读取 seccomp 配置中以终止进程方式拦截的系统调用
+func deniedSyscalls(profile []byte) ([]string, error) {
+	var parsed struct {
+		Syscalls []struct {
+			Names  []string `json:"names"`
+			Action string   `json:"action"`
+		} `json:"syscalls"`
+	}
+	if err := json.Unmarshal(profile, &parsed); err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, rule := range parsed.Syscalls {
+		if rule.Action == "SCMP_ACT_KILL_PROCESS" {
+			names = append(names, rule.Names...)
+		}
+	}
+	return names, nil
+}
+
+// jailSeccompFilter 将 Docker 后端拦截的系统调用编译为 bubblewrap 使用的 BPF 程序
+// jail 中的工具链来自宿主机，无法沿用白名单，因此只终止名单内的调用，其余放行
+// 架构不符或 x32 调用同样终止进程，当前架构不支持时返回 nil
+func jailSeccompFilter(profile []byte) ([]byte, error) {
+	if jailSeccompArch == 0 {
+		return nil, nil
+	}
+	names, err := deniedSyscalls(profile)
+	if err != nil {
+		return nil, err
+	}
+	// 名单中的部分调用在当前架构上不存在，跳过即可
+	var numbers []uint32
+	for _, name := range names {
+		if nr, ok := jailSyscallNumbers[name]; ok {
+			numbers = append(numbers, nr)
+		}
+	}
+	n := len(numbers)
+	if n > 250 {
+		return nil, fmt.Errorf("too many denied syscalls: %d", n)
+	}
+
+	const (
+		archOffset = 4          // seccomp_data.arch
+		nrOffset   = 0          // seccomp_data.nr
+		x32Bit     = 0x40000000 // __X32_SYSCALL_BIT
+	)
+	prog := []unix.SockFilter{
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: archOffset},
+		{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: 1, K: jailSeccompArch},
+		{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+		{Code: unix.BPF_LD | unix.BPF_W | unix.BPF_ABS, K: nrOffset},
+		{Code: unix.BPF_JMP | unix.BPF_JGE | unix.BPF_K, Jt: uint8(n + 1), K: x32Bit},
+	}
+	for i, nr := range numbers {
+		prog = append(prog, unix.SockFilter{Code: unix.BPF_JMP | unix.BPF_JEQ | unix.BPF_K, Jt: uint8(n - i), K: nr})
+	}
+	prog = append(prog,
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_ALLOW},
+		unix.SockFilter{Code: unix.BPF_RET | unix.BPF_K, K: unix.SECCOMP_RET_KILL_PROCESS},
+	)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.NativeEndian, prog); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// createCgroup 创建一次执行专用的 cgroup 并写入资源限制
+func (b *JailBackend) createCgroup(memoryLimit int) (string, error) {
+	cgroup := filepath.Join(b.cgroupRoot, fmt.Sprintf("run_%d", time.Now().UnixNano()))
+	if err := os.Mkdir(cgroup, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cgroup: %w", err)
+	}
+
+	limits := map[string]string{}
+	if memoryLimit > 0 {
+		limits["memory.max"] = strconv.FormatInt(int64(memoryLimit)*1024, 10)
+		limits["memory.swap.max"] = "0"
+		limits["memory.oom.group"] = "1"
+	}
+	if b.config.PidsLimit > 0 {
+		limits["pids.max"] = strconv.FormatInt(b.config.PidsLimit, 10)
+	}
+	if b.config.NanoCPUs > 0 {
+		limits["cpu.max"] = fmt.Sprintf("%d 100000", int64(b.config.NanoCPUs*100000))
+	}
+
+	for name, value := range limits {
+		err := os.WriteFile(filepath.Join(cgroup, name), []byte(value), 0644)
+		// 未启用 swap 记账时不存在 memory.swap.max
+		if err != nil && !(name == "memory.swap.max" && errors.Is(err, os.ErrNotExist)) {
+			removeCgroup(cgroup)
+			return "", fmt.Errorf("failed to set %s: %w", name, err)
+		}
+	}
+	return cgroup, nil
+}
+
+// killCgroup 终止 cgroup 中的所有进程
+func killCgroup(cgroup string) error {
+	return os.WriteFile(filepath.Join(cgroup, "cgroup.kill"), []byte("1"), 0644)
+}
+
+// removeCgroup 删除 cgroup，进程被终止后需要短暂等待其退出
+func removeCgroup(cgroup string) {
+	for range 100 {
+		if err := os.Remove(cgroup); err == nil || errors.Is(err, os.ErrNotExist) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readCgroupInt 读取只包含一个整数的 cgroup 文件
+func readCgroupInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// cgroupOOMKilled 判断 cgroup 中是否有进程因超出内存限制被终止
+func cgroupOOMKilled(cgroup string) bool {
+	data, err := os.ReadFile(filepath.Join(cgroup, "memory.events"))
+	if err != nil {
+		return false
+	}
+	return parseMemoryEvents(data)["oom_kill"] > 0
+}
+
+// parseMemoryEvents 解析 memory.events 的 "key value" 行
+func parseMemoryEvents(data []byte) map[string]int64 {
+	events := map[string]int64{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(scanner.Text(), " ")
+		if !found {
+			continue
+		}
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			events[key] = n
+		}
+	}
+	return events
+}
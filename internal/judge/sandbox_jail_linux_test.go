@@ -0,0 +1,121 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"JudgeCore/internal/global"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestParseMemoryEvents(t *testing.T) {
+	events := parseMemoryEvents([]byte("low 0\nhigh 0\nmax 12\noom 1\noom_kill 1\noom_group_kill 0\n"))
+	if events["oom_kill"] != 1 || events["max"] != 12 {
+		t.Error(events)
+	}
+	if len(parseMemoryEvents(nil)) != 0 {
+		t.Error("expected no events")
+	}
+}
+
+func TestJailSeccompFilter(t *testing.T) {
+	if jailSeccompArch == 0 {
+		t.Skip("seccomp filter is not supported on this architecture")
+	}
+	filter, err := jailSeccompFilter(seccompProfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prog := make([]unix.SockFilter, len(filter)/8)
+	if _, err := binary.Decode(filter, binary.NativeEndian, prog); err != nil {
+		t.Fatal(err)
+	}
+
+	var denied []uint32
+	for _, ins := range prog {
+		if ins.Code == unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K && ins.K != jailSeccompArch {
+			denied = append(denied, ins.K)
+		}
+	}
+	for _, name := range []string{"ptrace", "mount", "keyctl", "bpf", "unshare", "setns", "perf_event_open"} {
+		if !slices.Contains(denied, jailSyscallNumbers[name]) {
+			t.Errorf("%s is not denied", name)
+		}
+	}
+	if last := prog[len(prog)-1]; last.K != unix.SECCOMP_RET_KILL_PROCESS {
+		t.Errorf("last instruction %+v", last)
+	}
+}
+
+// TestJailSandbox 在真实的 bubblewrap 与 cgroup 中验证资源限制，环境不满足时跳过
+func TestJailSandbox(t *testing.T) {
+	if _, err := exec.LookPath("bwrap"); err != nil {
+		t.Skip("bubblewrap is not installed")
+	}
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 is not installed")
+	}
+	const pidsLimit = 16
+	cgroupRoot := filepath.Join(defaultCgroupRoot, fmt.Sprintf("test_%d", os.Getpid()))
+	backend, err := newJailBackend(config.Sandbox{Backend: BackendJail, PidsLimit: pidsLimit, CgroupRoot: cgroupRoot})
+	if err != nil {
+		t.Skipf("jail backend is not available: %v", err)
+	}
+	defer os.Remove(cgroupRoot)
+
+	sb, err := backend.Create(t.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	problem := &global.Problem{Timelimit: "1s", Memorylimit: "64MB"}
+	testCases := []*global.TestCaseRequest{{InputData: "", OutputData: ""}}
+
+	// 超出时间限制
+	result := CompileAndRun("tle.py", []byte("while True: pass"), sb, nil, problem, testCases, JudgeOptions{})
+	if result.Status != global.TimeLimitExceeded {
+		t.Errorf("tle: %+v", result)
+	}
+
+	// 超出内存限制，由 cgroup 的 memory.max 终止
+	result = CompileAndRun("mle.py", []byte("x = b'1' * (256 * 1024 * 1024)"), sb, nil, problem, testCases, JudgeOptions{})
+	if result.Status != global.MemoryLimitExceeded {
+		t.Errorf("mle: %+v", result)
+	}
+
+	// pids.max 限制同时存在的进程数，超出后 fork 失败
+	forkBomb := `import os, time
+n = 0
+try:
+    for i in range(64):
+        if os.fork() == 0:
+            time.sleep(0.5)
+            os._exit(0)
+        n += 1
+except OSError:
+    pass
+print(n)`
+	run := RunWithInput("pids.py", []byte(forkBomb), sb, nil, problem, "")
+	n, err := strconv.Atoi(strings.TrimSpace(run.Stdout))
+	if err != nil || n >= pidsLimit {
+		t.Errorf("pids: %+v", run)
+	}
+
+	// 被拦截的系统调用按受限函数判定
+	if jailSeccompArch != 0 {
+		ptrace := fmt.Sprintf("import ctypes\nctypes.CDLL(None).syscall(%d, 0, 0, 0, 0)", unix.SYS_PTRACE)
+		result = CompileAndRun("ptrace.py", []byte(ptrace), sb, nil, problem, testCases, JudgeOptions{})
+		if result.Status != global.RestrictedFunction {
+			t.Errorf("ptrace: %+v", result)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"errors"
+)
+
+func newJailBackend(sandboxConfig config.Sandbox) (Backend, error) {
+	return nil, errors.New("jail sandbox backend is only supported on Linux")
+}
@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+
+package judge
+
+// jailSeccompArch 为 0 表示当前架构不安装 seccomp 过滤器
+const jailSeccompArch = 0
+
+var jailSyscallNumbers = map[string]uint32{}
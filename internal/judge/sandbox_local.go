@@ -0,0 +1,263 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// LocalBackend 直接在宿主机上以子进程运行代码的沙盒后端，依赖 rlimit 与可选的命名空间隔离，无需 Docker
+// 仅隔离网络等内核资源，不隔离文件系统，适用于开发机与 CI，不应用于评测不可信代码
+type LocalBackend struct {
+	config    config.Sandbox
+	toolchain string // Setup 时记录的宿主机编译器版本
+}
+
+// localSandbox 宿主机临时目录中的沙盒，任务在其下的独立目录中执行
+type localSandbox struct {
+	dir        string
+	namespaces bool
+	taskDir    string
+	filename   string
+}
+
+// hostToolchain 汇总宿主机上各语言编译器的版本，未安装的编译器记为 unavailable
+func hostToolchain(ctx context.Context) string {
+	var versions strings.Builder
+	for _, ext := range slices.Sorted(maps.Keys(compilerVersionCommands)) {
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		output, err := exec.CommandContext(ctx, "sh", "-c", compilerVersionCommands[ext]).CombinedOutput()
+		cancel()
+		version := strings.TrimSpace(string(output))
+		if err != nil {
+			version = "unavailable"
+		}
+		fmt.Fprintf(&versions, "%s: %s\n", ext, version)
+	}
+	return versions.String()
+}
+
+func newLocalBackend(sandboxConfig config.Sandbox) (Backend, error) {
+	if sandboxConfig.LocalNS && !localNamespacesSupported {
+		return nil, errors.New("local sandbox namespaces are only supported on Linux, set local_ns to false")
+	}
+	log.Println("[FeasOJ] Warning: local sandbox backend does not isolate the filesystem, do not judge untrusted code with it")
+	return &LocalBackend{config: sandboxConfig}, nil
+}
+
+func (b *LocalBackend) Name() string {
+	return BackendLocal
+}
+
+// Setup 本地后端直接使用宿主机上的工具链，只记录编译器版本
+func (b *LocalBackend) Setup(ctx context.Context, language string) error {
+	if b.toolchain == "" {
+		b.toolchain = hostToolchain(ctx)
+	}
+	return nil
+}
+
+func (b *LocalBackend) toolchainVersion() string {
+	return b.toolchain
+}
+
+func (b *LocalBackend) NetworkIsolated() bool {
+	return b.config.LocalNS
+}
+
+// Create 在系统临时目录中创建一个新的沙盒目录，工具链来自宿主机，与语言无关
+func (b *LocalBackend) Create(ctx context.Context, language string) (Sandbox, error) {
+	dir, err := os.MkdirTemp("", "judgecore-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	return &localSandbox{dir: dir, namespaces: b.config.LocalNS}, nil
+}
+
+func (s *localSandbox) ID() string {
+	return filepath.Base(s.dir)
+}
+
+// Prepare 创建任务目录并写入代码
+func (s *localSandbox) Prepare(ctx context.Context, filename string, code []byte) error {
+	taskDir := filepath.Join(s.dir, fmt.Sprintf("task_%d", time.Now().UnixNano()))
+	if err := os.Mkdir(taskDir, 0700); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(taskDir, filename), code, 0600); err != nil {
+		return err
+	}
+
+	s.taskDir = taskDir
+	s.filename = filename
+	return nil
+}
+
+// Compile 编译任务目录中的代码，编译失败时返回编译输出
+func (s *localSandbox) Compile(ctx context.Context) (string, error) {
+	script := compileScript(filepath.Ext(s.filename), s.filename, s.taskDir)
+	if script == "" {
+		return "", nil
+	}
+
+	output := &limitedBuffer{limit: maxOutputSize}
+	exitCode, _, err := s.exec(ctx, script, nil, output, output)
+	return compileResult(ctx, output.String(), exitCode, err)
+}
+
+// SaveArtifact 在宿主机上打包任务目录
+func (s *localSandbox) SaveArtifact(ctx context.Context) ([]byte, error) {
+	return archiveDir(s.taskDir)
+}
+
+// LoadArtifact 在宿主机上将归档解包到任务目录
+func (s *localSandbox) LoadArtifact(ctx context.Context, artifact []byte) error {
+	return extractArchive(s.taskDir, artifact)
+}
+
+// Run 使用给定输入运行已编译的程序，耗时与内存峰值由宿主进程统计，不依赖 /usr/bin/time
+func (s *localSandbox) Run(ctx context.Context, stdin io.Reader, limits Limits) (*ExecResult, RunStat, error) {
+	cmdStr := buildRunCommand(filepath.Ext(s.filename), s.filename, s.taskDir, limits.MemoryLimit)
+	if cmdStr == "" {
+		return nil, RunStat{}, fmt.Errorf("unsupported source file: %s", s.filename)
+	}
+
+	script := localRunScript(cmdStr, s.taskDir, limits.MemoryLimit)
+	return runWithDeadline(ctx, limits, func(ctx context.Context, stdout, stderr io.Writer) (int, RunStat, error) {
+		exitCode, state, err := s.exec(ctx, script, stdin, stdout, stderr)
+		if err != nil {
+			return exitCode, RunStat{}, err
+		}
+		return exitCode, RunStat{MemoryKB: maxRSSKB(state)}, nil
+	})
+}
+
+// localRunScript 生成在任务目录中运行程序的脚本，memoryLimit 为 0 时不设置虚拟内存限制
+func localRunScript(cmd, taskDir string, memoryLimit int) string {
+	script := fmt.Sprintf("cd %s || exit 1; export HOME=%s TMPDIR=%s; ", taskDir, taskDir, taskDir)
+	if memoryLimit > 0 {
+		script += fmt.Sprintf("ulimit -v %d || exit 1; ", memoryLimit)
+	}
+	return script + "exec " + cmd
+}
+
+// runWithDeadline 在时间限制内执行 run 并统计墙钟耗时，超时与 timeout 命令一致以退出码 124 表示
+func runWithDeadline(ctx context.Context, limits Limits, run func(ctx context.Context, stdout, stderr io.Writer) (int, RunStat, error)) (*ExecResult, RunStat, error) {
+	runCtx, cancel := context.WithTimeout(ctx, time.Duration(limits.TimeLimit)*time.Second)
+	defer cancel()
+
+	stdout := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: maxOutputSize}
+	start := time.Now()
+	exitCode, stat, err := run(runCtx, stdout, stderr)
+	elapsed := time.Since(start)
+
+	res := &ExecResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: exitCode}
+	if ctx.Err() == nil && runCtx.Err() == context.DeadlineExceeded {
+		res.ExitCode = 124
+		return res, RunStat{TimeMs: int64(limits.TimeLimit) * 1000, MemoryKB: stat.MemoryKB}, nil
+	}
+	if err != nil {
+		return res, RunStat{}, err
+	}
+
+	stat.TimeMs = elapsed.Milliseconds()
+	if exitCode > 128 {
+		stat.Signal = exitCode - 128
+	}
+	return res, stat, nil
+}
+
+func (s *localSandbox) Exec(ctx context.Context, script string, stdin io.Reader) (*ExecResult, error) {
+	stdout := &limitedBuffer{limit: maxOutputSize}
+	stderr := &limitedBuffer{limit: maxOutputSize}
+
+	exitCode, _, err := s.exec(ctx, script, stdin, stdout, stderr)
+	return &ExecResult{Stdout: stdout.Bytes(), Stderr: stderr.Bytes(), ExitCode: exitCode}, err
+}
+
+// Ping 确认沙盒目录仍然存在
+func (s *localSandbox) Ping(ctx context.Context) error {
+	info, err := os.Stat(s.dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", s.dir)
+	}
+	return nil
+}
+
+// Cleanup 删除沙盒目录下的所有任务目录与临时文件
+func (s *localSandbox) Cleanup(ctx context.Context) error {
+	s.taskDir = ""
+	s.filename = ""
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *localSandbox) Close() error {
+	return os.RemoveAll(s.dir)
+}
+
+// exec 在沙盒目录中通过 sh 执行脚本，返回退出码与进程状态，上下文取消时终止整个进程组
+func (s *localSandbox) exec(ctx context.Context, script string, stdin io.Reader, stdout, stderr io.Writer) (int, *os.ProcessState, error) {
+	cmd := exec.CommandContext(ctx, "sh", "-c", script)
+	cmd.Dir = s.dir
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH"), "HOME=" + s.dir, "TMPDIR=" + s.dir, "LANG=C.UTF-8"}
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.SysProcAttr = localSysProcAttr(s.namespaces)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd.Process)
+	}
+
+	exitCode, state, err := runCommand(ctx, cmd)
+	// 终止脚本留在后台的进程，脱离进程组的进程只能由 jail 后端的 cgroup 处理
+	if cmd.Process != nil {
+		killProcessGroup(cmd.Process)
+	}
+	return exitCode, state, err
+}
+
+// runCommand 运行已配置好的命令，非零退出不视为错误，上下文取消时返回上下文错误
+func runCommand(ctx context.Context, cmd *exec.Cmd) (int, *os.ProcessState, error) {
+	cmd.WaitDelay = time.Second
+
+	err := cmd.Run()
+	if ctx.Err() != nil {
+		return -1, cmd.ProcessState, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitStatus(exitErr.ProcessState), exitErr.ProcessState, nil
+	}
+	// 后台进程仍持有输出管道，进程本身已正常退出
+	if errors.Is(err, exec.ErrWaitDelay) {
+		return exitStatus(cmd.ProcessState), cmd.ProcessState, nil
+	}
+	if err != nil {
+		return -1, cmd.ProcessState, err
+	}
+	return 0, cmd.ProcessState, nil
+}
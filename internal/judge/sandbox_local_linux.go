@@ -0,0 +1,42 @@
+package judge
+
+import (
+	"os"
+	"syscall"
+)
+
+// localNamespacesSupported 当前平台是否支持为本地沙盒创建命名空间
+const localNamespacesSupported = true
+
+// localSysProcAttr 将子进程放入独立进程组，并按需创建用户、网络、IPC、UTS 命名空间
+// 用户命名空间内只映射当前用户自身，无需特权即可创建其余命名空间
+func localSysProcAttr(namespaces bool) *syscall.SysProcAttr {
+	attr := &syscall.SysProcAttr{Setpgid: true, Pdeathsig: syscall.SIGKILL}
+	if namespaces {
+		attr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	}
+	return attr
+}
+
+// killProcessGroup 终止子进程及其所在进程组中的所有进程
+func killProcessGroup(process *os.Process) error {
+	return syscall.Kill(-process.Pid, syscall.SIGKILL)
+}
+
+// exitStatus 获取进程退出码，被信号终止时与 sh 一致返回 128+信号值
+func exitStatus(state *os.ProcessState) int {
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return state.ExitCode()
+}
+
+// maxRSSKB 获取进程内存峰值 (KB)，Linux 下 ru_maxrss 的单位即为 KB
+func maxRSSKB(state *os.ProcessState) int64 {
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		return usage.Maxrss
+	}
+	return 0
+}
@@ -0,0 +1,31 @@
+//go:build !linux
+
+package judge
+
+import (
+	"os"
+	"syscall"
+)
+
+// localNamespacesSupported 当前平台是否支持为本地沙盒创建命名空间
+const localNamespacesSupported = false
+
+// localSysProcAttr 非 Linux 平台不创建命名空间
+func localSysProcAttr(namespaces bool) *syscall.SysProcAttr {
+	return nil
+}
+
+// killProcessGroup 非 Linux 平台仅终止子进程本身
+func killProcessGroup(process *os.Process) error {
+	return process.Kill()
+}
+
+// exitStatus 获取进程退出码
+func exitStatus(state *os.ProcessState) int {
+	return state.ExitCode()
+}
+
+// maxRSSKB 非 Linux 平台不统计内存峰值
+func maxRSSKB(state *os.ProcessState) int64 {
+	return 0
+}
@@ -0,0 +1,43 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"JudgeCore/internal/global"
+	"os/exec"
+	"testing"
+)
+
+func TestLocalSandbox(t *testing.T) {
+	if _, err := exec.LookPath("python"); err != nil {
+		t.Skip("python is not installed")
+	}
+
+	backend, err := NewBackend(config.Sandbox{Backend: BackendLocal}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sb, err := backend.Create(t.Context(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sb.Close()
+
+	problem := &global.Problem{Timelimit: "1s", Memorylimit: "256MB"}
+	testCases := []*global.TestCaseRequest{{InputData: "2", OutputData: "4"}}
+
+	// 正确答案
+	result := CompileAndRun("a.py", []byte("print(int(input()) * 2)"), sb, nil, problem, testCases, JudgeOptions{})
+	if result.Status != global.Accepted {
+		t.Error(result)
+	}
+
+	// 超出时间限制
+	result = CompileAndRun("b.py", []byte("while True: pass"), sb, nil, problem, testCases, JudgeOptions{})
+	if result.Status != global.TimeLimitExceeded {
+		t.Error(result)
+	}
+
+	if err := sb.Cleanup(t.Context()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,83 @@
+package judge
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// publicProbeAddress 用于验证沙盒无法访问外网的公网地址
+const publicProbeAddress = "1.1.1.1:53"
+
+// VerifyNetworkIsolation 在沙盒内尝试连接给定地址，确认网络已被隔离
+func (p *JudgePool) VerifyNetworkIsolation(targets []string) error {
+	if !p.backend.NetworkIsolated() {
+		log.Printf("[FeasOJ] Warning: %s sandbox network is not isolated, submissions can open network connections", p.backend.Name())
+		return nil
+	}
+
+	// 各语言镜像内的工具不同，每个子池分别检查
+	for _, language := range p.Languages() {
+		if err := p.verifySubPool(language, targets); err != nil {
+			return err
+		}
+	}
+
+	log.Println("[FeasOJ] Sandbox network isolation verified")
+	return nil
+}
+
+// verifySubPool 在指定语言子池的沙盒内检查网卡并尝试连接给定地址
+func (p *JudgePool) verifySubPool(language string, targets []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	sb, err := p.AcquireContainer(ctx, language)
+	if err != nil {
+		return err
+	}
+	defer p.ReleaseContainer(sb)
+
+	// 禁用网络后沙盒内只应存在回环网卡，/proc/net/dev 跟随网络命名空间，本地后端也适用
+	res, err := sb.Exec(ctx, "tail -n +3 /proc/net/dev | cut -d: -f1", nil)
+	if err != nil {
+		return fmt.Errorf("failed to list sandbox interfaces: %w", err)
+	}
+	if ifaces := strings.Fields(string(res.Stdout)); len(ifaces) != 1 || ifaces[0] != "lo" {
+		return fmt.Errorf("sandbox has network interfaces: %v", ifaces)
+	}
+
+	for _, target := range append([]string{publicProbeAddress}, targets...) {
+		host, port, err := net.SplitHostPort(target)
+		if err != nil {
+			log.Printf("[FeasOJ] Skip network probe for invalid address %q", target)
+			continue
+		}
+
+		res, err := sb.Exec(ctx, fmt.Sprintf("nc -w 2 %s %s </dev/null", host, port), nil)
+		if err != nil {
+			return fmt.Errorf("failed to probe %s from sandbox: %w", target, err)
+		}
+		if res.ExitCode == 127 {
+			// 无法探测时不能确认网络已隔离
+			return fmt.Errorf("nc is not available in %s sandbox, install it in the sandbox image to verify network isolation", p.pools[language].name())
+		}
+		if res.ExitCode == 0 {
+			return fmt.Errorf("%s sandbox can connect to %s", p.pools[language].name(), target)
+		}
+	}
+
+	return nil
+}
+
+// ProbeAddress 从连接字符串 (host:port 或 URL) 中提取 host:port
+func ProbeAddress(address string) string {
+	if u, err := url.Parse(address); err == nil && u.Host != "" {
+		return u.Host
+	}
+	return address
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package judge
+
+import "io/fs"
+
+// linkCount 非 Unix 平台无法获取硬链接数量
+func linkCount(info fs.FileInfo) (uint64, bool) {
+	return 0, false
+}
@@ -0,0 +1,17 @@
+//go:build unix
+
+package judge
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// linkCount 获取文件的硬链接数量
+func linkCount(info fs.FileInfo) (uint64, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Nlink), true
+}
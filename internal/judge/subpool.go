@@ -0,0 +1,459 @@
+package judge
+
+import (
+	"JudgeCore/internal/config"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHealthCheck 未配置时空闲沙盒的健康检查间隔
+	defaultHealthCheck = 30 * time.Second
+	// pingTimeout 单次健康检查的超时时间
+	pingTimeout = 10 * time.Second
+	// maxRetryBackoff 创建沙盒失败后重试的最长等待时间
+	maxRetryBackoff = 30 * time.Second
+)
+
+// pooledSandbox 池中沙盒的使用记录
+type pooledSandbox struct {
+	createdAt time.Time
+	uses      int
+}
+
+// subPool 使用同一语言镜像的沙盒池
+type subPool struct {
+	pool          chan Sandbox
+	mutex         sync.Mutex
+	sandboxConfig config.Sandbox
+	backend       Backend
+	language      string   // 语言镜像名，为空表示包含所有工具链的共享池
+	sandboxes     sync.Map // 沙盒ID -> Sandbox
+	stats         map[string]*pooledSandbox
+	minSize       int           // 沙盒数量下限
+	maxSize       int           // 沙盒数量上限
+	target        int           // 目标沙盒数量，由自动扩缩容在上下限之间调整
+	size          int           // 当前存活的沙盒数量，包括正在使用的
+	closed        bool          // 池已关闭，不再接收归还的沙盒
+	replenishing  bool          // 是否有补充沙盒的协程在运行
+	lastBusy      time.Time     // 最近一次负载不低于目标数量的时间，用于缩容冷却
+	onResize      func()        // 目标数量变化时的回调
+	wait          waitStats     // 获取沙盒的等待时间统计
+	cache         *compileCache // 编译产物缓存，未启用时为 nil
+	done          chan struct{}
+}
+
+// AcquireStats 获取沙盒的等待时间统计
+type AcquireStats struct {
+	Acquired  int64   `json:"acquired"`    // 成功获取的次数
+	Failed    int64   `json:"failed"`      // 因超时、取消或池关闭而失败的次数
+	Waiting   int64   `json:"waiting"`     // 当前正在等待的调用数
+	AvgWaitMs float64 `json:"avg_wait_ms"` // 成功获取的平均等待时间
+	MaxWaitMs int64   `json:"max_wait_ms"` // 成功获取的最长等待时间
+}
+
+// waitStats 累计获取沙盒的等待时间
+type waitStats struct {
+	mutex     sync.Mutex
+	acquired  int64
+	failed    int64
+	waiting   int64
+	totalWait time.Duration
+	maxWait   time.Duration
+}
+
+func (w *waitStats) begin() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.waiting++
+}
+
+func (w *waitStats) end(start time.Time, acquired bool) {
+	wait := time.Since(start)
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.waiting--
+	if !acquired {
+		w.failed++
+		return
+	}
+	w.acquired++
+	w.totalWait += wait
+	w.maxWait = max(w.maxWait, wait)
+}
+
+func (w *waitStats) snapshot() AcquireStats {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	stats := AcquireStats{
+		Acquired:  w.acquired,
+		Failed:    w.failed,
+		Waiting:   w.waiting,
+		MaxWaitMs: w.maxWait.Milliseconds(),
+	}
+	if w.acquired > 0 {
+		stats.AvgWaitMs = float64(w.totalWait) / float64(w.acquired) / float64(time.Millisecond)
+	}
+	return stats
+}
+
+// newSubPool 创建一个新的语言沙盒池
+func newSubPool(sandboxConfig config.Sandbox, backend Backend, language string) *subPool {
+	return &subPool{
+		sandboxConfig: sandboxConfig,
+		backend:       backend,
+		language:      language,
+		stats:         make(map[string]*pooledSandbox),
+		done:          make(chan struct{}),
+	}
+}
+
+// name 子池名称，用于日志
+func (p *subPool) name() string {
+	if p.language == "" {
+		return p.backend.Name()
+	}
+	return p.backend.Name() + "/" + p.language
+}
+
+// initialize 按最小数量预热沙盒池，创建失败时持续重试直到达到目标数量，之后启动后台健康检查
+// maxSize 为自动扩缩容的上限，不大于 minSize 时池大小固定
+func (p *subPool) initialize(minSize, maxSize int) {
+	maxSize = max(minSize, maxSize)
+	p.pool = make(chan Sandbox, maxSize)
+	p.minSize = minSize
+	p.maxSize = maxSize
+	p.target = minSize
+
+	backoff := time.Second
+	for len(p.pool) < minSize {
+		sb, err := p.createSandbox()
+		if err != nil {
+			log.Printf("[FeasOJ] Error starting %s sandbox during preheat (%d/%d): %v, retrying in %s", p.name(), len(p.pool), minSize, err, backoff)
+			time.Sleep(backoff)
+			backoff = min(backoff*2, maxRetryBackoff)
+			continue
+		}
+		p.pool <- sb
+		backoff = time.Second
+	}
+	p.lastBusy = time.Now()
+	log.Printf("[FeasOJ] Preheated %d %s sandboxes", len(p.pool), p.name())
+
+	go p.healthLoop()
+}
+
+// acquire 从池中获取一个可用的空闲沙盒（若池为空则阻塞等待），并记录等待时间
+// 上下文结束时返回上下文错误，池关闭后返回 ErrPoolClosed
+func (p *subPool) acquire(ctx context.Context) (Sandbox, error) {
+	start := time.Now()
+	p.wait.begin()
+	for {
+		select {
+		case <-ctx.Done():
+			p.wait.end(start, false)
+			return nil, ctx.Err()
+		case sb, ok := <-p.pool:
+			if !ok {
+				p.wait.end(start, false)
+				return nil, ErrPoolClosed
+			}
+			if err := p.ping(sb); err != nil {
+				log.Printf("[FeasOJ] Sandbox %s failed validation on acquire: %v, replacing it", sb.ID(), err)
+				p.destroySandbox(sb)
+				go p.replenish()
+				continue
+			}
+			p.wait.end(start, true)
+			return sb, nil
+		}
+	}
+}
+
+// tryAcquire 不等待地取出至多 n 个可用的空闲沙盒
+func (p *subPool) tryAcquire(n int) []Sandbox {
+	var sandboxes []Sandbox
+	for len(sandboxes) < n {
+		select {
+		case sb, ok := <-p.pool:
+			if !ok {
+				return sandboxes
+			}
+			if err := p.ping(sb); err != nil {
+				log.Printf("[FeasOJ] Sandbox %s failed validation on acquire: %v, replacing it", sb.ID(), err)
+				p.destroySandbox(sb)
+				go p.replenish()
+				continue
+			}
+			sandboxes = append(sandboxes, sb)
+		default:
+			return sandboxes
+		}
+	}
+	return sandboxes
+}
+
+// release 清理沙盒后将其归还到池中，清理失败时销毁并在后台替换
+// 达到使用次数或存活时间上限的沙盒不再归还，而是在后台退役
+func (p *subPool) release(sb Sandbox) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err := sb.Cleanup(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("[FeasOJ] Reset failed for sandbox %s: %v, terminating it", sb.ID(), err)
+		p.destroySandbox(sb)
+		go p.replenish()
+		return
+	}
+
+	p.mutex.Lock()
+	if stat, ok := p.stats[sb.ID()]; ok {
+		stat.uses++
+	}
+	p.mutex.Unlock()
+
+	if reason := p.expired(sb); reason != "" {
+		go p.retire(sb, reason)
+		return
+	}
+	p.put(sb)
+}
+
+// shutdown 在服务关闭时销毁池中所有沙盒
+func (p *subPool) shutdown() {
+	p.mutex.Lock()
+	p.closed = true
+	close(p.done)
+	close(p.pool)
+	p.mutex.Unlock()
+
+	log.Printf("[FeasOJ] Shutting down %s sandbox pool...", p.name())
+	p.sandboxes.Range(func(key, value interface{}) bool {
+		sb := value.(Sandbox)
+		if err := sb.Close(); err != nil {
+			log.Printf("[FeasOJ] Error terminating sandbox %s: %v", sb.ID(), err)
+			return true
+		}
+		log.Printf("[FeasOJ] Terminated sandbox %s", sb.ID())
+		return true
+	})
+}
+
+// targetSize 获取当前目标沙盒数量
+func (p *subPool) targetSize() int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.target
+}
+
+// resize 在上下限范围内调整目标沙盒数量，扩容在后台进行，缩容立即销毁多余的空闲沙盒
+// 正在使用的多余沙盒在归还时销毁
+func (p *subPool) resize(n int) {
+	p.mutex.Lock()
+	n = min(max(n, p.minSize), p.maxSize)
+	if p.closed || n == p.target {
+		p.mutex.Unlock()
+		return
+	}
+	log.Printf("[FeasOJ] Resizing %s sandbox pool from %d to %d", p.name(), p.target, n)
+	p.target = n
+trim:
+	for p.size > p.target {
+		select {
+		case sb := <-p.pool:
+			p.destroySandboxLocked(sb)
+		default:
+			break trim
+		}
+	}
+	onResize := p.onResize
+	p.mutex.Unlock()
+
+	if onResize != nil {
+		onResize()
+	}
+	go p.replenish()
+}
+
+// put 将有效沙盒放回池中，池已满、已关闭或超出目标数量时销毁
+func (p *subPool) put(sb Sandbox) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if !p.closed && p.size <= p.target {
+		select {
+		case p.pool <- sb:
+			return
+		default:
+		}
+	}
+	log.Printf("[FeasOJ] Pool is full or closed. Terminating extra sandbox %s", sb.ID())
+	p.destroySandboxLocked(sb)
+}
+
+// ping 在超时时间内检查沙盒是否可用
+func (p *subPool) ping(sb Sandbox) error {
+	ctx, cancel := context.WithTimeout(context.Background(), pingTimeout)
+	defer cancel()
+	return sb.Ping(ctx)
+}
+
+// healthLoop 定期检查空闲沙盒并补足数量，直到池关闭
+func (p *subPool) healthLoop() {
+	interval := defaultHealthCheck
+	if p.sandboxConfig.HealthCheck > 0 {
+		interval = time.Duration(p.sandboxConfig.HealthCheck) * time.Second
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.checkIdle()
+			p.replenish()
+		}
+	}
+}
+
+// checkIdle 逐个取出当前空闲的沙盒进行存活检查，失效的沙盒被销毁
+func (p *subPool) checkIdle() {
+	for range len(p.pool) {
+		var sb Sandbox
+		select {
+		case s, ok := <-p.pool:
+			if !ok {
+				return
+			}
+			sb = s
+		default:
+			return
+		}
+
+		if err := p.ping(sb); err != nil {
+			log.Printf("[FeasOJ] Sandbox %s failed health check: %v, replacing it", sb.ID(), err)
+			p.destroySandbox(sb)
+			continue
+		}
+		if reason := p.expired(sb); reason != "" {
+			go p.retire(sb, reason)
+			continue
+		}
+		p.put(sb)
+	}
+}
+
+// expired 判断沙盒是否达到使用次数或存活时间上限，返回退役原因
+func (p *subPool) expired(sb Sandbox) string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	stat, ok := p.stats[sb.ID()]
+	if !ok {
+		return ""
+	}
+	if p.sandboxConfig.MaxUses > 0 && stat.uses >= p.sandboxConfig.MaxUses {
+		return fmt.Sprintf("served %d tasks", stat.uses)
+	}
+	if maxAge := time.Duration(p.sandboxConfig.MaxAge) * time.Minute; maxAge > 0 && time.Since(stat.createdAt) >= maxAge {
+		return fmt.Sprintf("alive for %s", time.Since(stat.createdAt).Round(time.Second))
+	}
+	return ""
+}
+
+// retire 在后台创建替换沙盒后销毁旧沙盒，归还沙盒的任务无需等待替换完成
+func (p *subPool) retire(sb Sandbox, reason string) {
+	log.Printf("[FeasOJ] Retiring sandbox %s: %s", sb.ID(), reason)
+
+	replacement, err := p.createSandbox()
+	p.destroySandbox(sb)
+	if err != nil {
+		log.Printf("[FeasOJ] Failed to start replacement for retired sandbox %s: %v", sb.ID(), err)
+		p.replenish()
+		return
+	}
+	p.put(replacement)
+}
+
+// replenish 创建沙盒直到达到目标数量，失败时退避重试，同一时间只有一个协程在补充
+func (p *subPool) replenish() {
+	p.mutex.Lock()
+	if p.replenishing || p.closed {
+		p.mutex.Unlock()
+		return
+	}
+	p.replenishing = true
+	p.mutex.Unlock()
+
+	defer func() {
+		p.mutex.Lock()
+		p.replenishing = false
+		p.mutex.Unlock()
+	}()
+
+	backoff := time.Second
+	for {
+		p.mutex.Lock()
+		missing := p.target - p.size
+		closed := p.closed
+		p.mutex.Unlock()
+		if missing <= 0 || closed {
+			return
+		}
+
+		sb, err := p.createSandbox()
+		if err != nil {
+			log.Printf("[FeasOJ] Failed to start replacement sandbox: %v, retrying in %s", err, backoff)
+			select {
+			case <-p.done:
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, maxRetryBackoff)
+			continue
+		}
+		backoff = time.Second
+		p.put(sb)
+	}
+}
+
+// createSandbox 通过后端创建沙盒并记录，用于关闭时统一销毁
+func (p *subPool) createSandbox() (Sandbox, error) {
+	sb, err := p.backend.Create(context.Background(), p.language)
+	if err != nil {
+		return nil, err
+	}
+	p.sandboxes.Store(sb.ID(), sb)
+
+	p.mutex.Lock()
+	p.size++
+	p.stats[sb.ID()] = &pooledSandbox{createdAt: time.Now()}
+	p.mutex.Unlock()
+	return sb, nil
+}
+
+// destroySandbox 异步销毁沙盒
+func (p *subPool) destroySandbox(sb Sandbox) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.destroySandboxLocked(sb)
+}
+
+// destroySandboxLocked 与 destroySandbox 相同，调用方需持有 mutex
+func (p *subPool) destroySandboxLocked(sb Sandbox) {
+	if _, loaded := p.sandboxes.LoadAndDelete(sb.ID()); loaded {
+		p.size--
+	}
+	delete(p.stats, sb.ID())
+	go func() {
+		if err := sb.Close(); err != nil {
+			log.Printf("[FeasOJ] Error terminating sandbox %s: %v", sb.ID(), err)
+		}
+	}()
+}
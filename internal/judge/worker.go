@@ -5,7 +5,13 @@ import (
 	"JudgeCore/internal/global"
 	"JudgeCore/internal/utils"
 	"JudgeCore/internal/utils/sql"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -16,13 +22,65 @@ import (
 )
 
 type Task struct {
-	UID  int
-	PID  int
-	Name string
+	Type       string
+	UID        int
+	PID        int
+	Name       string
+	RunID      string
+	Language   string
+	Code       string
+	Input      string
+	CasePolicy string
+	SID        int // 提交ID，为 0 时按用户与题目更新 "Running..." 的提交记录
+	JobID      string
 }
 
-// ProcessJudgeTasks 函数用于处理判题任务
-func ProcessJudgeTasks(rmqConfig config.RabbitMQ, db *gorm.DB, pool *JudgePool) {
+// delivery 待处理的任务及其队列消息，处理完成后确认
+type delivery struct {
+	task Task
+	msg  amqp.Delivery
+}
+
+// consumerTag 判题任务队列的消费者标签，用于停止消费
+const consumerTag = "judgecore"
+
+// errDrainAborted 关闭时排空超时，任务结果被丢弃并重新入队
+var errDrainAborted = errors.New("drain deadline exceeded")
+
+// TaskProcessor 消费判题任务队列，关闭时停止消费并等待进行中的任务完成
+type TaskProcessor struct {
+	rmqConfig config.RabbitMQ
+	db        *gorm.DB
+	pool      *JudgePool
+	stopOnce  sync.Once
+	stop      chan struct{} // 停止消费新任务
+	abort     chan struct{} // 排空超时，放弃进行中的任务
+	done      chan struct{} // 所有 worker 已退出
+	chMutex   sync.Mutex
+	ch        *amqp.Channel // 当前消费使用的通道，排空超时时关闭
+}
+
+// abortGrace 排空超时后等待 worker 退出的时间
+const abortGrace = 5 * time.Second
+
+// NewTaskProcessor 创建判题任务处理器
+func NewTaskProcessor(rmqConfig config.RabbitMQ, db *gorm.DB, pool *JudgePool) *TaskProcessor {
+	return &TaskProcessor{
+		rmqConfig: rmqConfig,
+		db:        db,
+		pool:      pool,
+		stop:      make(chan struct{}),
+		abort:     make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Run 处理判题任务，直到调用 Drain 或通道关闭
+// worker 数量与通道预取数跟随沙盒池的目标大小，未处理的任务留在队列中供自动扩缩容判断积压
+func (t *TaskProcessor) Run() {
+	defer close(t.done)
+	rmqConfig, db, pool := t.rmqConfig, t.db, t.pool
+
 	var conn *amqp.Connection
 	var ch *amqp.Channel
 	var err error
@@ -37,28 +95,46 @@ func ProcessJudgeTasks(rmqConfig config.RabbitMQ, db *gorm.DB, pool *JudgePool)
 		log.Println("[FeasOJ] RabbitMQ connected")
 		break
 	}
-	defer conn.Close()
-	defer ch.Close()
+	t.setChannel(ch)
+	// 重连后 conn 与 ch 会被替换，关闭最终使用的连接
+	defer func() {
+		ch.Close()
+		conn.Close()
+	}()
 
-	taskChan := make(chan Task)
-	var wg sync.WaitGroup
+	taskChan := make(chan delivery)
+	workers := &workerGroup{run: func(stop <-chan struct{}) {
+		worker(stop, t.abort, taskChan, t.channel, db, pool)
+	}}
+	workers.resize(pool.Target())
+	pool.OnResize(func(n int) {
+		workers.resize(n)
+		// 重连后通道会被替换，总是使用当前通道
+		if err := t.channel().Qos(n, 0, true); err != nil {
+			log.Printf("[FeasOJ] Failed to update prefetch count: %v", err)
+		}
+	})
 
-	for i := 0; i < pool.sandboxConfig.MaxConcurrent; i++ {
-		wg.Add(1)
-		go worker(taskChan, ch, &wg, db, pool)
-	}
+	inspector := &queueInspector{config: rmqConfig, queue: "judgeTask"}
+	defer inspector.close()
+	go pool.Autoscale(inspector.depth)
 
 	for {
-		// 获取队列中的任务
-		msgs, err := ch.Consume(
-			"judgeTask", // 队列名称
-			"",          // 消费者标签
-			true,        // 自动应答
-			false,       // 是否排他
-			false,       // 是否持久化
-			false,       // 是否等待
-			nil,         // 额外参数
-		)
+		// 每个 worker 同时只持有一条未确认的消息
+		err := ch.Qos(pool.Target(), 0, true)
+		var msgs <-chan amqp.Delivery
+		if err == nil {
+			// 获取队列中的任务
+			msgs, err = ch.Consume(
+				"judgeTask", // 队列名称
+				consumerTag, // 消费者标签
+				false,       // 处理完成后手动应答
+				false,       // 是否排他
+				false,       // 是否持久化
+				false,       // 是否等待
+				nil,         // 额外参数
+			)
+		}
 		if err != nil {
 			log.Println("[FeasOJ] Failed to start consuming, retrying in 3s: ", err)
 			time.Sleep(3 * time.Second)
@@ -74,65 +150,408 @@ func ProcessJudgeTasks(rmqConfig config.RabbitMQ, db *gorm.DB, pool *JudgePool)
 				}
 				break
 			}
+			t.setChannel(ch)
+			// 新通道的预取数回到循环开头按当前目标大小重新设置
 			continue
 		}
 
-		for msg := range msgs {
-			taskData := string(msg.Body)
-			parts := strings.Split(taskData, "_")
-			if len(parts) < 2 {
-				log.Printf("[FeasOJ] Invalid task data format: %s", taskData)
+		if t.consume(ch, msgs, taskChan) {
+			log.Println("[FeasOJ] Stopped consuming judge tasks, waiting for in-flight tasks")
+		} else {
+			log.Println("[FeasOJ] RabbitMQ channel closed. Exiting task processor.")
+		}
+		break
+	}
+
+	close(taskChan)
+	workers.wait()
+}
+
+// consume 将队列消息分发给 worker，收到停止信号时取消消费并退回已预取的消息
+// 返回是否因停止信号退出
+func (t *TaskProcessor) consume(ch *amqp.Channel, msgs <-chan amqp.Delivery, taskChan chan<- delivery) bool {
+	for {
+		select {
+		case <-t.stop:
+			if err := ch.Cancel(consumerTag, false); err != nil {
+				log.Printf("[FeasOJ] Failed to cancel consumer: %v", err)
+			}
+			for msg := range msgs {
+				msg.Nack(false, true)
+			}
+			return true
+		case msg, ok := <-msgs:
+			if !ok {
+				return false
+			}
+			task, err := parseTask(msg.Body)
+			if err != nil {
+				log.Printf("[FeasOJ] Invalid task data format: %s", string(msg.Body))
+				msg.Reject(false)
 				continue
 			}
-			uid, _ := strconv.Atoi(parts[0])
-			pidStr := strings.Split(parts[1], ".")[0]
-			pid, _ := strconv.Atoi(pidStr)
 
-			taskChan <- Task{UID: uid, PID: pid, Name: taskData}
+			select {
+			case taskChan <- delivery{task: task, msg: msg}:
+			case <-t.stop:
+				msg.Nack(false, true)
+			}
 		}
-		log.Println("[FeasOJ] RabbitMQ channel closed. Exiting task processor.")
-		break
 	}
+}
 
-	close(taskChan)
-	wg.Wait()
+// Drain 停止消费新任务并等待进行中的任务完成，返回是否在超时前全部完成
+// 超时后进行中的任务不再写入结果，并关闭通道使 RabbitMQ 立即将其未确认的消息重新入队
+// 仍在评测的 worker 无法再应答，不会等待其结束
+func (t *TaskProcessor) Drain(timeout time.Duration) bool {
+	t.stopOnce.Do(func() { close(t.stop) })
+
+	select {
+	case <-t.done:
+		return true
+	case <-time.After(timeout):
+	}
+
+	close(t.abort)
+	t.chMutex.Lock()
+	if t.ch != nil {
+		if err := t.ch.Close(); err != nil {
+			log.Printf("[FeasOJ] Failed to close RabbitMQ channel: %v", err)
+		}
+	}
+	t.chMutex.Unlock()
+
+	// 等待在获取沙盒等阶段被放弃的 worker 退出
+	select {
+	case <-t.done:
+	case <-time.After(abortGrace):
+	}
+	return false
+}
+
+// channel 获取当前消费使用的通道
+func (t *TaskProcessor) channel() *amqp.Channel {
+	t.chMutex.Lock()
+	defer t.chMutex.Unlock()
+	return t.ch
+}
+
+// setChannel 记录当前消费使用的通道
+func (t *TaskProcessor) setChannel(ch *amqp.Channel) {
+	t.chMutex.Lock()
+	defer t.chMutex.Unlock()
+	t.ch = ch
+}
+
+// workerGroup 数量可调整的 worker 协程组
+type workerGroup struct {
+	mutex sync.Mutex
+	stops []chan struct{}
+	wg    sync.WaitGroup
+	run   func(stop <-chan struct{})
+}
+
+// resize 增减 worker 数量，被停止的 worker 在处理完当前任务后退出
+func (g *workerGroup) resize(n int) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	for len(g.stops) < n {
+		stop := make(chan struct{})
+		g.stops = append(g.stops, stop)
+		g.wg.Add(1)
+		go func() {
+			defer g.wg.Done()
+			g.run(stop)
+		}()
+	}
+	for len(g.stops) > n {
+		close(g.stops[len(g.stops)-1])
+		g.stops = g.stops[:len(g.stops)-1]
+	}
+}
+
+// wait 等待所有 worker 退出
+func (g *workerGroup) wait() {
+	g.wg.Wait()
 }
 
-// worker 使用容器池执行任务
-func worker(taskChan chan Task, ch *amqp.Channel, wg *sync.WaitGroup, db *gorm.DB, pool *JudgePool) {
-	defer wg.Done()
+// queueInspector 使用独立的连接查询队列长度，查询失败时下次重新连接
+type queueInspector struct {
+	config config.RabbitMQ
+	queue  string
+	conn   *amqp.Connection
+	ch     *amqp.Channel
+}
 
-	for task := range taskChan {
-		problem, err := sql.SelectProblemByPid(db, task.PID)
+func (q *queueInspector) depth() (int, error) {
+	if q.ch == nil || q.ch.IsClosed() {
+		q.close()
+		conn, ch, err := utils.ConnectRabbitMQ(q.config)
 		if err != nil {
-			log.Printf("[FeasOJ] Failed to get problem info for PID %d: %v", task.PID, err)
-			continue
+			return 0, err
 		}
+		q.conn, q.ch = conn, ch
+	}
 
-		testCases := sql.SelectTestCasesByPid(db, task.PID)
-		if len(testCases) == 0 {
-			log.Printf("[FeasOJ] No test cases found for PID %d", task.PID)
-			sql.ModifyJudgeStatus(db, task.UID, task.PID, global.SystemError)
-			continue
+	n, err := utils.QueueDepth(q.ch, q.queue)
+	if err != nil {
+		q.close()
+	}
+	return n, err
+}
+
+func (q *queueInspector) close() {
+	if q.conn != nil {
+		q.conn.Close()
+	}
+	q.conn, q.ch = nil, nil
+}
+
+// parseTask 解析队列消息，支持JSON任务消息与旧的 "uid_pid.ext" 纯文本格式
+func parseTask(body []byte) (Task, error) {
+	if len(body) > 0 && body[0] == '{' {
+		var msg global.TaskMessage
+		if err := json.Unmarshal(body, &msg); err != nil {
+			return Task{}, err
+		}
+		if msg.Type == "" {
+			msg.Type = global.TaskTypeJudge
+		}
+		if msg.Type == global.TaskTypeJudge && !ValidSourceName(msg.Filename) {
+			return Task{}, fmt.Errorf("invalid filename: %s", msg.Filename)
 		}
+		if msg.Type == global.TaskTypeRejudge && (msg.SubmissionID <= 0 || msg.RejudgeJobID == "") {
+			return Task{}, fmt.Errorf("rejudge task without submission or job ID")
+		}
+		if !ValidCasePolicy(msg.CasePolicy) {
+			return Task{}, fmt.Errorf("invalid case policy: %s", msg.CasePolicy)
+		}
+		return Task{
+			Type:       msg.Type,
+			UID:        msg.UserID,
+			PID:        msg.ProblemID,
+			Name:       msg.Filename,
+			RunID:      msg.RunID,
+			Language:   msg.Language,
+			Code:       msg.Code,
+			Input:      msg.Input,
+			CasePolicy: msg.CasePolicy,
+			SID:        msg.SubmissionID,
+			JobID:      msg.RejudgeJobID,
+		}, nil
+	}
+
+	taskData := string(body)
+	parts := strings.Split(taskData, "_")
+	if len(parts) < 2 || !ValidSourceName(taskData) {
+		return Task{}, fmt.Errorf("invalid task data: %s", taskData)
+	}
+	uid, _ := strconv.Atoi(parts[0])
+	pidStr := strings.Split(parts[1], ".")[0]
+	pid, _ := strconv.Atoi(pidStr)
+
+	return Task{Type: global.TaskTypeJudge, UID: uid, PID: pid, Name: taskData}, nil
+}
+
+// worker 使用沙盒池执行任务，处理完成后确认消息，未能获取沙盒或排空超时时将消息重新入队
+// 收到停止信号或任务通道关闭时退出
+func worker(stop, abort <-chan struct{}, taskChan <-chan delivery, channel func() *amqp.Channel, db *gorm.DB, pool *JudgePool) {
+	for {
+		select {
+		case <-stop:
+			return
+		case d, ok := <-taskChan:
+			if !ok {
+				return
+			}
+
+			// 结果通过当前通道发布，重连前的通道已关闭
+			ch := channel()
+			var err error
+			switch d.task.Type {
+			case global.TaskTypeRun:
+				err = runTask(d.task, abort, ch, db, pool)
+			case global.TaskTypeRejudge:
+				err = rejudgeTask(d.task, abort, db, pool)
+			default:
+				err = judgeTask(d.task, abort, ch, db, pool)
+			}
+			if err != nil {
+				// 任务未完成，重新入队由其他 worker 或实例处理
+				log.Printf("[FeasOJ] Requeueing %s task for PID %d: %v", d.task.Type, d.task.PID, err)
+				d.msg.Nack(false, true)
+				continue
+			}
+			d.msg.Ack(false)
+		}
+	}
+}
 
-		containerID := pool.AcquireContainer()
-		pool.containerIDs.Store(task.Name, containerID)
+// judgeTask 评测提交的代码文件并发布评测结果
+// 未能获取沙盒或评测期间排空超时时不写入结果，返回错误并保留代码文件
+func judgeTask(task Task, abort <-chan struct{}, ch *amqp.Channel, db *gorm.DB, pool *JudgePool) error {
+	var result *global.JudgeResult
+	code, err := os.ReadFile(filepath.Join(pool.codeDir, task.Name))
+	if err != nil {
+		log.Printf("[FeasOJ] Failed to read code file %s: %v", task.Name, err)
+		result = &global.JudgeResult{Status: global.SystemError}
+	} else {
+		result, err = judgeSource(db, pool, task.PID, task.Name, code, task.CasePolicy)
+		var acquireErr *AcquireError
+		if errors.As(err, &acquireErr) {
+			return err
+		}
+		if aborted(abort) {
+			// 沙盒可能已被销毁，结果不可信
+			return errDrainAborted
+		}
 
-		result := CompileAndRun(task.Name, containerID, problem, testCases)
-		sql.ModifyJudgeStatus(db, task.UID, task.PID, result)
+		// 评测结束后删除磁盘上的代码
+		RemoveSource(pool.codeDir, task.Name, code)
+		if err != nil {
+			// 题目、测试样例或评测设置读取失败时仍需写入结果，避免提交一直处于评测中
+			log.Printf("[FeasOJ] Failed to load judge data for PID %d: %v", task.PID, err)
+			result = &global.JudgeResult{Status: global.SystemError}
+		}
+	}
+	if task.SID > 0 {
+		sql.ModifySubmitResultBySid(db, task.SID, result.Status)
+	} else {
+		sql.ModifyJudgeStatus(db, task.UID, task.PID, result.Status)
+	}
+
+	resultMsg := global.JudgeResultMessage{
+		UserID:    task.UID,
+		ProblemID: task.PID,
+		Status:    result.Status,
+		Cases:     result.Cases,
+	}
+
+	if err := utils.PublishJudgeResult(ch, resultMsg); err != nil {
+		log.Printf("[FeasOJ] Failed to publish result: %v", err)
+	}
+	return nil
+}
+
+// runTask 使用自定义输入运行代码并发布运行结果，不写入提交记录
+// 未能获取沙盒或运行期间排空超时时不发布结果并返回错误
+func runTask(task Task, abort <-chan struct{}, ch *amqp.Channel, db *gorm.DB, pool *JudgePool) error {
+	resultMsg := global.RunResultMessage{
+		RunID:     task.RunID,
+		UserID:    task.UID,
+		ProblemID: task.PID,
+	}
 
-		resultMsg := global.JudgeResultMessage{
-			UserID:    task.UID,
-			ProblemID: task.PID,
-			Status:    result,
+	problem, err := LoadLimits(db, task.PID, 0, 0)
+	ext, ok := LanguageExt(task.Language)
+	switch {
+	case err != nil:
+		log.Printf("[FeasOJ] Failed to get problem info for PID %d: %v", task.PID, err)
+		resultMsg.Result = &global.RunResult{Status: global.SystemError}
+	case !ok:
+		log.Printf("[FeasOJ] Unsupported language for run %s: %s", task.RunID, task.Language)
+		resultMsg.Result = &global.RunResult{Status: global.SystemError}
+	default:
+		resultMsg.Result, err = pool.Run(context.Background(), SourceName("run", ext), []byte(task.Code), problem, task.Input)
+		if err != nil {
+			return err
+		}
+		if aborted(abort) {
+			return errDrainAborted
 		}
+	}
+
+	if err := utils.PublishRunResult(ch, resultMsg); err != nil {
+		log.Printf("[FeasOJ] Failed to publish run result: %v", err)
+	}
+	return nil
+}
+
+// aborted 判断排空是否已超时
+func aborted(abort <-chan struct{}) bool {
+	select {
+	case <-abort:
+		return true
+	default:
+		return false
+	}
+}
+
+// judgeSource 加载题目信息、测试样例与评测设置，并从容器池中取出容器评测指定代码文件
+// policy 为空时使用评测设置中的测试点运行策略
+func judgeSource(db *gorm.DB, pool *JudgePool, pid int, filename string, code []byte, policy string) (*global.JudgeResult, error) {
+	problem, err := sql.SelectProblemByPid(db, pid)
+	if err != nil {
+		return nil, err
+	}
+
+	testCases := sql.SelectTestCasesByPid(db, pid)
+	if len(testCases) == 0 {
+		log.Printf("[FeasOJ] No test cases found for PID %d", pid)
+		return &global.JudgeResult{Status: global.SystemError}, nil
+	}
+
+	opts, err := LoadJudgeOptions(db, problem, policy, 0, pool.MaxParallelCases())
+	if err != nil {
+		return nil, err
+	}
+	return pool.Judge(context.Background(), filename, code, problem, testCases, opts)
+}
 
-		if err := utils.PublishJudgeResult(ch, resultMsg); err != nil {
-			log.Printf("[FeasOJ] Failed to publish result: %v", err)
+// LoadJudgeOptions 根据题目及其所属竞赛的评测设置生成评测选项，未指定题目时使用默认选项
+// parallel 大于0时覆盖题目设置的并行测试点数量，结果不超过 maxParallel
+// 测试点运行策略依次取 policy、题目设置、竞赛设置，均为空时在首个未通过的测试点停止
+func LoadJudgeOptions(db *gorm.DB, problem *global.Problem, policy string, parallel, maxParallel int) (JudgeOptions, error) {
+	var opts JudgeOptions
+	if problem.Pid > 0 {
+		setting, err := sql.SelectJudgeSetting(db, problem.Pid)
+		if err != nil {
+			return JudgeOptions{}, err
+		}
+		opts.Parallel = setting.ParallelCases
+		if policy == "" {
+			policy = setting.CasePolicy
+		}
+	}
+	if policy == "" && problem.ContestID > 0 {
+		setting, err := sql.SelectContestJudgeSetting(db, problem.ContestID)
+		if err != nil {
+			return JudgeOptions{}, err
 		}
+		policy = setting.CasePolicy
+	}
 
-		pool.ReleaseContainer(containerID)
-		pool.containerIDs.Delete(task.Name)
+	if parallel > 0 {
+		opts.Parallel = parallel
+	}
+	opts.Parallel = min(opts.Parallel, max(maxParallel, 1))
+	opts.RunAll = policy == global.CasePolicyRunAll
+	return opts, nil
+}
+
+// ValidCasePolicy 判断测试点运行策略是否有效，空字符串表示使用评测设置
+func ValidCasePolicy(policy string) bool {
+	switch policy {
+	case "", global.CasePolicyStopOnFailure, global.CasePolicyRunAll:
+		return true
+	}
+	return false
+}
+
+// LoadLimits 获取题目的时间与内存限制，未指定题目时使用给定限制，未给定 (不大于0) 时使用默认值 (1秒、256MB)
+func LoadLimits(db *gorm.DB, pid int, timeLimit, memoryLimit int) (*global.Problem, error) {
+	if pid > 0 {
+		return sql.SelectProblemByPid(db, pid)
+	}
+	if timeLimit <= 0 {
+		timeLimit = 1
+	}
+	if memoryLimit <= 0 {
+		memoryLimit = 256
 	}
+	return &global.Problem{
+		Timelimit:   strconv.Itoa(timeLimit),
+		Memorylimit: strconv.Itoa(memoryLimit),
+	}, nil
 }
@@ -37,3 +37,13 @@ func RegService(client *api.Client, consulConfig config.Consul, serverConfig con
 	log.Println("[FeasOJ] JudgeCore service registered successfully")
 	return nil
 }
+
+// DeregService 服务注销，关闭前调用以免网关继续转发请求
+func DeregService(client *api.Client, consulConfig config.Consul) error {
+	if err := client.Agent().ServiceDeregister(consulConfig.ServiceID); err != nil {
+		log.Println("[FeasOJ] JudgeCore service deregistration failed:", err)
+		return err
+	}
+	log.Println("[FeasOJ] JudgeCore service deregistered successfully")
+	return nil
+}
@@ -38,6 +38,26 @@ func ConnectRabbitMQ(rmqConfig config.RabbitMQ) (*amqp.Connection, *amqp.Channel
 	return conn, ch, nil
 }
 
+// PublishTask 将任务消息发布到判题任务队列
+func PublishTask(ch *amqp.Channel, task global.TaskMessage) error {
+	body, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+
+	return ch.Publish(
+		"",
+		"judgeTask",
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         body,
+		},
+	)
+}
+
 // PublishJudgeResult 将判题结果发布到消息队列
 func PublishJudgeResult(ch *amqp.Channel, result global.JudgeResultMessage) error {
 	_, err := ch.QueueDeclare(
@@ -69,3 +89,44 @@ func PublishJudgeResult(ch *amqp.Channel, result global.JudgeResultMessage) erro
 		},
 	)
 }
+
+// PublishRunResult 将自定义输入运行结果发布到消息队列
+func PublishRunResult(ch *amqp.Channel, result global.RunResultMessage) error {
+	_, err := ch.QueueDeclare(
+		"runResults", // 队列名称
+		true,         // 持久化
+		false,        // 自动删除
+		false,        // 排他性
+		false,        // 不等待
+		nil,          // 参数
+	)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	return ch.Publish(
+		"",
+		"runResults",
+		false,
+		false,
+		amqp.Publishing{
+			DeliveryMode: amqp.Persistent,
+			ContentType:  "application/json",
+			Body:         body,
+		},
+	)
+}
+
+// QueueDepth 获取队列中等待投递的消息数，队列不存在时服务端会关闭该通道
+func QueueDepth(ch *amqp.Channel, name string) (int, error) {
+	queue, err := ch.QueueDeclarePassive(name, true, false, false, false, nil)
+	if err != nil {
+		return 0, err
+	}
+	return queue.Messages, nil
+}
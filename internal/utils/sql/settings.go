@@ -0,0 +1,45 @@
+package sql
+
+import (
+	"JudgeCore/internal/global"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SelectJudgeSetting 获取指定题目的评测设置，未设置时返回默认值
+func SelectJudgeSetting(db *gorm.DB, pid int) (*global.JudgeSetting, error) {
+	setting := global.JudgeSetting{Pid: pid}
+	result := db.Where("pid = ?", pid).First(&setting)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return &setting, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &setting, nil
+}
+
+// SaveJudgeSetting 创建或更新题目的评测设置
+func SaveJudgeSetting(db *gorm.DB, setting *global.JudgeSetting) error {
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(setting).Error
+}
+
+// SelectContestJudgeSetting 获取指定竞赛的评测设置，未设置时返回默认值
+func SelectContestJudgeSetting(db *gorm.DB, contestID int) (*global.ContestJudgeSetting, error) {
+	setting := global.ContestJudgeSetting{ContestID: contestID}
+	result := db.Where("contest_id = ?", contestID).First(&setting)
+	if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return &setting, nil
+	}
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &setting, nil
+}
+
+// SaveContestJudgeSetting 创建或更新竞赛的评测设置
+func SaveContestJudgeSetting(db *gorm.DB, setting *global.ContestJudgeSetting) error {
+	return db.Clauses(clause.OnConflict{UpdateAll: true}).Create(setting).Error
+}
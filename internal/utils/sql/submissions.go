@@ -0,0 +1,87 @@
+package sql
+
+import (
+	"JudgeCore/internal/global"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SelectSubmitRecordBySid 获取指定提交记录
+func SelectSubmitRecordBySid(db *gorm.DB, sid int) (*global.SubmitRecord, error) {
+	var record global.SubmitRecord
+	result := db.Table("submit_records").Where("sid = ?", sid).First(&record)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &record, nil
+}
+
+// SelectSubmitRecordsByPid 获取指定题目的全部提交记录
+func SelectSubmitRecordsByPid(db *gorm.DB, pid int) ([]*global.SubmitRecord, error) {
+	var records []*global.SubmitRecord
+	result := db.Table("submit_records").Where("pid = ?", pid).Order("sid").Find(&records)
+	return records, result.Error
+}
+
+// SelectSubmitRecordsByContestID 获取指定竞赛下所有题目的提交记录
+func SelectSubmitRecordsByContestID(db *gorm.DB, contestID int) ([]*global.SubmitRecord, error) {
+	var records []*global.SubmitRecord
+	result := db.Table("submit_records").
+		Select("submit_records.*").
+		Joins("JOIN problems ON problems.pid = submit_records.pid").
+		Where("problems.contest_id = ?", contestID).
+		Order("submit_records.sid").
+		Find(&records)
+	return records, result.Error
+}
+
+// ModifySubmitResultBySid 修改指定提交记录的状态
+func ModifySubmitResultBySid(db *gorm.DB, sid int, result string) error {
+	return db.Table("submit_records").Where("sid = ?", sid).Update("result", result).Error
+}
+
+// InsertRejudgeRecord 写入重判审计记录，同一重判任务中已有该提交的记录时忽略
+func InsertRejudgeRecord(db *gorm.DB, record *global.RejudgeRecord) error {
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(record).Error
+}
+
+// InsertRejudgeJob 写入重判任务
+func InsertRejudgeJob(db *gorm.DB, job *global.RejudgeJob) error {
+	return db.Create(job).Error
+}
+
+// ModifyRejudgeJobTotal 修改重判任务的提交记录数量
+func ModifyRejudgeJobTotal(db *gorm.DB, id string, total int) error {
+	return db.Model(&global.RejudgeJob{}).Where("id = ?", id).Update("total", total).Error
+}
+
+// SelectRejudgeJob 获取指定重判任务
+func SelectRejudgeJob(db *gorm.DB, id string) (*global.RejudgeJob, error) {
+	var job global.RejudgeJob
+	result := db.Where("id = ?", id).First(&job)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	return &job, nil
+}
+
+// SelectRecentRejudgeJobs 获取最近创建的重判任务
+func SelectRecentRejudgeJobs(db *gorm.DB, limit int) ([]*global.RejudgeJob, error) {
+	var jobs []*global.RejudgeJob
+	result := db.Order("created_at DESC").Limit(limit).Find(&jobs)
+	return jobs, result.Error
+}
+
+// SelectRejudgeProgress 统计重判任务已完成、结果改变与失败的提交记录数量
+func SelectRejudgeProgress(db *gorm.DB, jobID string) (*global.RejudgeProgress, error) {
+	var progress global.RejudgeProgress
+	result := db.Model(&global.RejudgeRecord{}).
+		Select("COUNT(*) AS done, "+
+			"COALESCE(SUM(CASE WHEN new_result <> '' AND new_result <> old_result THEN 1 ELSE 0 END), 0) AS changed, "+
+			"COALESCE(SUM(CASE WHEN new_result = '' THEN 1 ELSE 0 END), 0) AS failed, "+
+			"MAX(created_at) AS last_done").
+		Where("job_id = ?", jobID).
+		Scan(&progress)
+	return &progress, result.Error
+}
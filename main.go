@@ -2,16 +2,23 @@ package main
 
 import (
 	"JudgeCore/internal/config"
+	"JudgeCore/internal/global"
 	"JudgeCore/internal/judge"
 	"JudgeCore/internal/utils"
 	"JudgeCore/server"
+	"JudgeCore/server/middlewares"
 	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/hashicorp/consul/api"
@@ -54,6 +61,11 @@ func main() {
 	}
 	log.Println("[FeasOJ] MySQL initialization complete")
 
+	// 同步JudgeCore自有的数据表
+	if err := db.AutoMigrate(&global.RejudgeJob{}, &global.RejudgeRecord{}, &global.JudgeSetting{}, &global.ContestJudgeSetting{}); err != nil {
+		log.Fatalf("[FeasOJ] Failed to migrate JudgeCore tables: %v", err)
+	}
+
 	// 初始化Consul客户端
 	consulConfig := api.DefaultConfig()
 	consulConfig.Address = cfg.Consul.Address
@@ -63,34 +75,67 @@ func main() {
 		log.Fatalf("[FeasOJ] Error connecting to Consul: %v", err)
 	}
 
-	// 构建沙盒镜像
-	if !judge.BuildImage(currentDir) {
-		log.Fatalf("[FeasOJ] SandBox builds fail, please make sure Docker is running and up to date")
+	// 初始化沙盒池
+	judgePool, err := judge.NewJudgePool(cfg.Sandbox, cfg.Consul.ServiceID, codeDir)
+	if err != nil {
+		log.Fatalf("[FeasOJ] Failed to create sandbox pool: %v", err)
+	}
+
+	// 准备各子池使用的沙盒镜像，Docker 后端在镜像不存在时构建或拉取
+	if err := judgePool.Setup(); err != nil {
+		log.Fatalf("[FeasOJ] SandBox setup failed, please make sure Docker is running and up to date: %v", err)
 	}
-	log.Println("[FeasOJ] SandBox builds successfully")
+	log.Println("[FeasOJ] SandBox is ready")
 
-	// 初始化并预热容器池
-	judgePool := judge.NewJudgePool(cfg.Sandbox, codeDir)
-	judgePool.Initialize(cfg.Sandbox.MaxConcurrent)
+	// 预热沙盒池
+	judgePool.Initialize()
+
+	// 确认沙盒无法访问数据库、消息队列等内部服务
+	probeTargets := []string{
+		cfg.Database.Address,
+		judge.ProbeAddress(cfg.RabbitMQ.Address),
+		judge.ProbeAddress(cfg.Consul.Address),
+	}
+	if err := judgePool.VerifyNetworkIsolation(probeTargets); err != nil {
+		log.Fatalf("[FeasOJ] Sandbox network isolation check failed: %v", err)
+	}
 
 	// 启动Judge任务处理协程
-	go judge.ProcessJudgeTasks(cfg.RabbitMQ, db, judgePool)
+	processor := judge.NewTaskProcessor(cfg.RabbitMQ, db, judgePool)
+	go processor.Run()
+
+	// 定期清理未被评测的上传代码
+	go judge.SweepSources(codeDir, time.Duration(cfg.Server.SourceTTL)*time.Minute)
 
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
-	server.LoadRouter(r, db, judgePool, codeDir)
+	server.LoadRouter(r, cfg.Server, cfg.Auth, cfg.RabbitMQ, db, judgePool, codeDir)
+
+	srv := &http.Server{
+		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Address, cfg.Server.Port),
+		Handler: r,
+	}
+	if cfg.Auth.Mode == middlewares.AuthModeMTLS {
+		if !cfg.Server.EnableHTTPS {
+			log.Fatalf("[FeasOJ] mTLS authentication requires enable_https")
+		}
+		tlsConfig, err := loadClientCAs(filepath.Join(certDir, filepath.Base(cfg.Auth.ClientCAPath)))
+		if err != nil {
+			log.Fatalf("[FeasOJ] Failed to load client CA: %v", err)
+		}
+		srv.TLSConfig = tlsConfig
+	}
 
 	go func() {
-		serverAddr := fmt.Sprintf("%s:%d", cfg.Server.Address, cfg.Server.Port)
 		var err error
 		if cfg.Server.EnableHTTPS {
 			certPath := filepath.Join(certDir, filepath.Base(cfg.Server.CertPath))
 			keyPath := filepath.Join(certDir, filepath.Base(cfg.Server.KeyPath))
-			err = r.RunTLS(serverAddr, certPath, keyPath)
+			err = srv.ListenAndServeTLS(certPath, keyPath)
 		} else {
-			err = r.Run(serverAddr)
+			err = srv.ListenAndServe()
 		}
-		if err != nil {
+		if err != nil && err != http.ErrServerClosed {
 			log.Fatalf("[FeasOJ] Server start error: %v\n", err)
 		}
 	}()
@@ -101,11 +146,30 @@ func main() {
 	}
 
 	// 优雅地关闭
-	gracefulShutdown(logFile, judgePool)
+	waitForExit()
+	drain(cfg, consulClient, srv, processor, judgePool)
+	utils.CloseLogger(logFile)
+	os.Exit(0)
+}
+
+// loadClientCAs 加载用于校验客户端证书的CA，未携带证书的请求仍可访问健康检查
+func loadClientCAs(caPath string) (*tls.Config, error) {
+	caPEM, err := os.ReadFile(caPath)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", caPath)
+	}
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}, nil
 }
 
-func gracefulShutdown(logFile *os.File, pool *judge.JudgePool) {
-	// 监听终端输入或中断信号
+// waitForExit 等待终端输入 exit 或中断信号
+func waitForExit() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 
@@ -121,9 +185,30 @@ func gracefulShutdown(logFile *os.File, pool *judge.JudgePool) {
 
 	log.Println("[FeasOJ] Input 'exit' or Ctrl+C to stop the server")
 	<-quit
+}
+
+// drain 依次停止消费任务并等待进行中的任务、注销服务、关闭HTTP服务，最后销毁沙盒
+// 超时未完成的任务不写入结果，其消息在通道关闭后由 RabbitMQ 重新投递给其他实例
+func drain(cfg *config.AppConfig, consulClient *api.Client, srv *http.Server, processor *judge.TaskProcessor, pool *judge.JudgePool) {
+	timeout := time.Duration(cfg.Server.DrainTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	log.Printf("[FeasOJ] The server is shutting down, waiting up to %s for in-flight tasks", timeout)
+
+	if processor.Drain(timeout) {
+		log.Println("[FeasOJ] All in-flight tasks finished")
+	} else {
+		log.Println("[FeasOJ] Drain timed out, unfinished tasks were returned to the queue")
+	}
+
+	utils.DeregService(consulClient, cfg.Consul)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("[FeasOJ] HTTP server shutdown error: %v", err)
+	}
 
-	log.Println("[FeasOJ] The server is shutting down, please be patient to wait for the container to be closed")
 	pool.Shutdown()
-	utils.CloseLogger(logFile)
-	os.Exit(0)
 }
@@ -1,38 +1,195 @@
 package handler
 
 import (
+	"JudgeCore/internal/config"
+	"JudgeCore/internal/global"
+	"JudgeCore/internal/judge"
+	"JudgeCore/internal/utils/sql"
+	"errors"
+	"io"
+	"log"
 	"net/http"
-	"path/filepath"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
-	CodeDir string
+	CodeDir       string
+	MaxSourceSize int64
+	DB            *gorm.DB
+	Pool          *judge.JudgePool
+	Rejudge       *judge.RejudgeManager
 }
 
-func NewHandler(codeDir string) *Handler {
-	return &Handler{CodeDir: codeDir}
+func NewHandler(serverConfig config.Server, rmqConfig config.RabbitMQ, db *gorm.DB, pool *judge.JudgePool, codeDir string) *Handler {
+	return &Handler{
+		CodeDir:       codeDir,
+		MaxSourceSize: serverConfig.MaxSourceSize,
+		DB:            db,
+		Pool:          pool,
+		Rejudge:       judge.NewRejudgeManager(rmqConfig, db),
+	}
 }
 
 func (h *Handler) Health(c *gin.Context) {
 	c.JSON(200, gin.H{
 		"status": "ok",
+		"pools":  h.Pool.AcquireStats(),
 	})
 }
 
 func (h *Handler) Judge(c *gin.Context) {
+	// 预留 multipart 表单的额外开销
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.maxSourceSize()+64*1024)
+
 	file, err := c.FormFile("code")
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to get form file"})
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Source too large"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to get form file"})
+		return
+	}
+
+	if err := validateFilename(file.Filename); err != nil {
+		respondSourceError(c, err)
+		return
+	}
+	if file.Size > h.maxSourceSize() {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"message": "Source too large"})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to read form file"})
 		return
 	}
+	defer src.Close()
 
-	savePath := filepath.Join(h.CodeDir, file.Filename)
-	if err := c.SaveUploadedFile(file, savePath); err != nil {
+	code, err := io.ReadAll(io.LimitReader(src, h.maxSourceSize()+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Failed to read form file"})
+		return
+	}
+	if err := validateSource(code, h.maxSourceSize()); err != nil {
+		respondSourceError(c, err)
+		return
+	}
+
+	digest, err := storeSource(h.CodeDir, file.Filename, code)
+	if err != nil {
+		log.Printf("[FeasOJ] Failed to save uploaded file %s: %v", file.Filename, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save file"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "File received"})
+	c.JSON(http.StatusOK, gin.H{"message": "File received", "sha256": digest})
+}
+
+// respondSourceError 将源代码校验错误转换为对应的HTTP响应
+func respondSourceError(c *gin.Context, err error) {
+	var srcErr *sourceError
+	if errors.As(err, &srcErr) {
+		c.JSON(srcErr.status, gin.H{"message": srcErr.message})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+}
+
+// JudgeSync 同步评测，直接通过容器池评测代码并在响应中返回结果
+func (h *Handler) JudgeSync(c *gin.Context) {
+	var req global.JudgeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+		return
+	}
+
+	ext, ok := judge.LanguageExt(req.Language)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unsupported language"})
+		return
+	}
+	if err := validateSource([]byte(req.Code), h.maxSourceSize()); err != nil {
+		respondSourceError(c, err)
+		return
+	}
+	if !judge.ValidCasePolicy(req.CasePolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid case policy"})
+		return
+	}
+
+	problem, testCases, status, message := h.loadJudgeData(&req)
+	if status != http.StatusOK {
+		c.JSON(status, gin.H{"message": message})
+		return
+	}
+
+	opts, err := judge.LoadJudgeOptions(h.DB, problem, req.CasePolicy, req.ParallelCases, h.Pool.MaxParallelCases())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to load judge settings"})
+		return
+	}
+
+	result, err := h.Pool.Judge(c.Request.Context(), judge.SourceName("sync", ext), []byte(req.Code), problem, testCases, opts)
+	if err != nil {
+		log.Printf("[FeasOJ] Sync judge failed: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "No sandbox available"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result})
+}
+
+// loadJudgeData 根据请求获取题目限制与测试样例，内联测试样例优先于题目自带样例
+func (h *Handler) loadJudgeData(req *global.JudgeRequest) (*global.Problem, []*global.TestCaseRequest, int, string) {
+	problem, err := judge.LoadLimits(h.DB, req.ProblemID, req.TimeLimit, req.MemoryLimit)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, "Problem not found"
+	}
+
+	testCases := req.TestCases
+	if len(testCases) == 0 && req.ProblemID > 0 {
+		testCases = sql.SelectTestCasesByPid(h.DB, req.ProblemID)
+	}
+	if len(testCases) == 0 {
+		return nil, nil, http.StatusBadRequest, "No test cases"
+	}
+
+	return problem, testCases, http.StatusOK, ""
+}
+
+// Run 使用自定义输入运行代码并返回输出，不写入提交记录
+func (h *Handler) Run(c *gin.Context) {
+	var req global.RunRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+		return
+	}
+
+	ext, ok := judge.LanguageExt(req.Language)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unsupported language"})
+		return
+	}
+	if err := validateSource([]byte(req.Code), h.maxSourceSize()); err != nil {
+		respondSourceError(c, err)
+		return
+	}
+
+	problem, err := judge.LoadLimits(h.DB, req.ProblemID, req.TimeLimit, req.MemoryLimit)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Problem not found"})
+		return
+	}
+
+	result, err := h.Pool.Run(c.Request.Context(), judge.SourceName("run", ext), []byte(req.Code), problem, req.Input)
+	if err != nil {
+		log.Printf("[FeasOJ] Run failed: %v", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"message": "No sandbox available"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"result": result})
 }
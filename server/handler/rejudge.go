@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"JudgeCore/internal/judge"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func (h *Handler) RejudgeSubmission(c *gin.Context) {
+	h.submitRejudge(c, judge.RejudgeScopeSubmission)
+}
+
+func (h *Handler) RejudgeProblem(c *gin.Context) {
+	h.submitRejudge(c, judge.RejudgeScopeProblem)
+}
+
+func (h *Handler) RejudgeContest(c *gin.Context) {
+	h.submitRejudge(c, judge.RejudgeScopeContest)
+}
+
+func (h *Handler) RejudgeJobs(c *gin.Context) {
+	jobs, err := h.Rejudge.Jobs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to load rejudge jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"jobs": jobs})
+}
+
+func (h *Handler) RejudgeJob(c *gin.Context) {
+	job, err := h.Rejudge.Job(c.Param("job_id"))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"message": "Rejudge job not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to load rejudge job"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
+
+// submitRejudge 解析路径中的ID并创建对应范围的重判任务
+func (h *Handler) submitRejudge(c *gin.Context, scope string) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+
+	job, err := h.Rejudge.Submit(scope, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, judge.ErrNoSubmissions) {
+			c.JSON(http.StatusNotFound, gin.H{"message": "No submissions to rejudge"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to create rejudge job"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"job": job})
+}
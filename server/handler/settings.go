@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"JudgeCore/internal/global"
+	"JudgeCore/internal/judge"
+	"JudgeCore/internal/utils/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProblemSetting 获取题目的评测设置
+func (h *Handler) ProblemSetting(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("id"))
+	if err != nil || pid <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+
+	setting, err := sql.SelectJudgeSetting(h.DB, pid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to load judge settings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"setting": setting})
+}
+
+// UpdateProblemSetting 修改题目的评测设置
+func (h *Handler) UpdateProblemSetting(c *gin.Context) {
+	pid, err := strconv.Atoi(c.Param("id"))
+	if err != nil || pid <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+
+	var setting global.JudgeSetting
+	if err := c.ShouldBindJSON(&setting); err != nil || setting.ParallelCases < 0 || !judge.ValidCasePolicy(setting.CasePolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+		return
+	}
+	if maxParallel := h.Pool.MaxParallelCases(); setting.ParallelCases > maxParallel {
+		c.JSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("parallel_cases exceeds the limit of %d", maxParallel)})
+		return
+	}
+	setting.Pid = pid
+
+	if err := sql.SaveJudgeSetting(h.DB, &setting); err != nil {
+		log.Printf("[FeasOJ] Failed to save judge settings for PID %d: %v", pid, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save judge settings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"setting": setting})
+}
+
+// ContestSetting 获取竞赛的评测设置
+func (h *Handler) ContestSetting(c *gin.Context) {
+	contestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || contestID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+
+	setting, err := sql.SelectContestJudgeSetting(h.DB, contestID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to load judge settings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"setting": setting})
+}
+
+// UpdateContestSetting 修改竞赛的评测设置，竞赛内未单独设置的题目使用该设置
+func (h *Handler) UpdateContestSetting(c *gin.Context) {
+	contestID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || contestID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid ID"})
+		return
+	}
+
+	var setting global.ContestJudgeSetting
+	if err := c.ShouldBindJSON(&setting); err != nil || !judge.ValidCasePolicy(setting.CasePolicy) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request body"})
+		return
+	}
+	setting.ContestID = contestID
+
+	if err := sql.SaveContestJudgeSetting(h.DB, &setting); err != nil {
+		log.Printf("[FeasOJ] Failed to save judge settings for contest %d: %v", contestID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Failed to save judge settings"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"setting": setting})
+}
@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"JudgeCore/internal/judge"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+)
+
+// defaultMaxSourceSize 未配置时的源代码大小上限 (64KB)
+const defaultMaxSourceSize = 64 * 1024
+
+// sourceError 源代码校验失败，携带应返回的HTTP状态码
+type sourceError struct {
+	status  int
+	message string
+}
+
+func (e *sourceError) Error() string {
+	return e.message
+}
+
+// maxSourceSize 获取源代码大小上限
+func (h *Handler) maxSourceSize() int64 {
+	if h.MaxSourceSize > 0 {
+		return h.MaxSourceSize
+	}
+	return defaultMaxSourceSize
+}
+
+// validateFilename 校验上传文件名与扩展名
+func validateFilename(filename string) error {
+	if !judge.ValidSourceName(filename) {
+		return &sourceError{http.StatusBadRequest, "Invalid filename"}
+	}
+	if !judge.SupportedExt(filepath.Ext(filename)) {
+		return &sourceError{http.StatusBadRequest, "Unsupported language"}
+	}
+	return nil
+}
+
+// validateSource 校验源代码大小与编码
+func validateSource(code []byte, maxSize int64) error {
+	if int64(len(code)) > maxSize {
+		return &sourceError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Source exceeds %d bytes", maxSize)}
+	}
+	if len(code) == 0 {
+		return &sourceError{http.StatusBadRequest, "Empty source"}
+	}
+	if bytes.IndexByte(code, 0) >= 0 {
+		return &sourceError{http.StatusBadRequest, "Source contains NUL bytes"}
+	}
+	if !utf8.Valid(code) {
+		return &sourceError{http.StatusBadRequest, "Source is not valid UTF-8"}
+	}
+	return nil
+}
+
+// storeSource 以内容哈希为名原子写入源代码，再将请求的文件名原子地指向该内容
+func storeSource(codeDir, filename string, code []byte) (string, error) {
+	sum := sha256.Sum256(code)
+	digest := hex.EncodeToString(sum[:])
+
+	objectPath := filepath.Join(codeDir, judge.SourceObjectName(code, filepath.Ext(filename)))
+	if _, err := os.Stat(objectPath); errors.Is(err, os.ErrNotExist) {
+		if err := writeFileAtomic(objectPath, code); err != nil {
+			return "", err
+		}
+	}
+
+	// 通过临时硬链接加重命名替换目标文件，评测进程不会读到写了一半的代码
+	tmpLink := filepath.Join(codeDir, fmt.Sprintf(".%s.%s.link", digest, rand.Text()))
+	err := os.Link(objectPath, tmpLink)
+	if errors.Is(err, os.ErrNotExist) {
+		// 副本在检查后被清理，重新写入
+		if err := writeFileAtomic(objectPath, code); err != nil {
+			return "", err
+		}
+		err = os.Link(objectPath, tmpLink)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpLink, filepath.Join(codeDir, filename)); err != nil {
+		os.Remove(tmpLink)
+		return "", err
+	}
+
+	return digest, nil
+}
+
+// writeFileAtomic 写入临时文件后重命名到目标路径
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
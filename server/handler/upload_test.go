@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateFilename(t *testing.T) {
+	valid := []string{"1_2.cpp", "12_345.java", "run-1.py"}
+	for _, name := range valid {
+		if err := validateFilename(name); err != nil {
+			t.Error(name, err)
+		}
+	}
+
+	invalid := []string{"../../config.json", "1_2.exe", ".1_2.cpp", "a/b.cpp", "1_2.tar.gz", ""}
+	for _, name := range invalid {
+		if err := validateFilename(name); err == nil {
+			t.Error(name)
+		}
+	}
+}
+
+func TestValidateSource(t *testing.T) {
+	if err := validateSource([]byte("int main() {}"), 64); err != nil {
+		t.Error(err)
+	}
+
+	var srcErr *sourceError
+	if err := validateSource(make([]byte, 65), 64); !errors.As(err, &srcErr) || srcErr.status != http.StatusRequestEntityTooLarge {
+		t.Error(err)
+	}
+	if err := validateSource([]byte("a\x00b"), 64); err == nil {
+		t.Error("NUL bytes accepted")
+	}
+	if err := validateSource([]byte{0xff, 0xfe}, 64); err == nil {
+		t.Error("invalid UTF-8 accepted")
+	}
+}
+
+func TestStoreSource(t *testing.T) {
+	dir := t.TempDir()
+
+	digest, err := storeSource(dir, "1_2.cpp", []byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "."+digest+".cpp")); err != nil {
+		t.Error(err)
+	}
+
+	// 重复上传同名文件时内容被原子替换
+	if _, err := storeSource(dir, "1_2.cpp", []byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "1_2.cpp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "second" {
+		t.Error(string(data))
+	}
+}
@@ -0,0 +1,210 @@
+package middlewares
+
+import (
+	"JudgeCore/internal/config"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 认证方式
+const (
+	AuthModeHMAC  = "hmac"
+	AuthModeToken = "token"
+	AuthModeMTLS  = "mtls"
+	AuthModeNone  = "none"
+)
+
+// 接口访问范围
+const (
+	ScopeJudge    = "judge"
+	ScopeRun      = "run"
+	ScopeRejudge  = "rejudge"
+	ScopeSettings = "settings"
+)
+
+// HMAC 签名请求头
+const (
+	HeaderTimestamp = "X-JudgeCore-Timestamp"
+	HeaderNonce     = "X-JudgeCore-Nonce"
+	HeaderSignature = "X-JudgeCore-Signature"
+)
+
+const (
+	// maxSignedBodySize 参与签名计算的请求体大小上限
+	maxSignedBodySize = 8 * 1024 * 1024
+	// maxNonceLength nonce 的长度上限
+	maxNonceLength = 128
+)
+
+// Authenticator 根据配置校验请求凭据
+type Authenticator struct {
+	config config.Auth
+	nonces *nonceCache
+}
+
+// NewAuthenticator 创建一个新的 Authenticator 实例
+func NewAuthenticator(authConfig config.Auth) *Authenticator {
+	switch authConfig.Mode {
+	case AuthModeHMAC, AuthModeToken, AuthModeMTLS:
+	case AuthModeNone:
+		log.Println("[FeasOJ] Warning: API authentication is disabled, anyone who can reach JudgeCore can submit code")
+	default:
+		log.Printf("[FeasOJ] Warning: unknown auth mode %q, all API requests except health will be rejected", authConfig.Mode)
+	}
+	if authConfig.Mode == AuthModeHMAC && authConfig.Secret == "" {
+		log.Println("[FeasOJ] Warning: HMAC auth has an empty secret, all API requests except health will be rejected")
+	}
+	return &Authenticator{config: authConfig, nonces: newNonceCache()}
+}
+
+// Require 返回要求请求具有指定访问范围的中间件
+func (a *Authenticator) Require(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		status := http.StatusUnauthorized
+		switch a.config.Mode {
+		case AuthModeNone:
+			status = http.StatusOK
+		case AuthModeHMAC:
+			if a.verifySignature(c) {
+				status = http.StatusOK
+			}
+		case AuthModeToken:
+			status = a.verifyToken(c, scope)
+		case AuthModeMTLS:
+			if c.Request.TLS != nil && len(c.Request.TLS.VerifiedChains) > 0 {
+				status = http.StatusOK
+			}
+		}
+
+		switch status {
+		case http.StatusOK:
+			c.Next()
+		case http.StatusForbidden:
+			c.AbortWithStatusJSON(status, gin.H{"message": "Insufficient scope"})
+		default:
+			c.AbortWithStatusJSON(status, gin.H{"message": "Unauthorized"})
+		}
+	}
+}
+
+// verifyToken 校验 Bearer Token 及其访问范围，返回对应的HTTP状态码
+func (a *Authenticator) verifyToken(c *gin.Context, scope string) int {
+	token, found := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !found || token == "" {
+		return http.StatusUnauthorized
+	}
+
+	for _, t := range a.config.Tokens {
+		if t.Token == "" || subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) != 1 {
+			continue
+		}
+		if slices.Contains(t.Scopes, scope) || slices.Contains(t.Scopes, "*") {
+			return http.StatusOK
+		}
+		return http.StatusForbidden
+	}
+	return http.StatusUnauthorized
+}
+
+// verifySignature 校验请求的 HMAC-SHA256 签名、时间戳与 nonce，时间偏差范围内重复使用的 nonce 被拒绝
+func (a *Authenticator) verifySignature(c *gin.Context) bool {
+	if a.config.Secret == "" {
+		return false
+	}
+
+	timestamp := c.GetHeader(HeaderTimestamp)
+	nonce := c.GetHeader(HeaderNonce)
+	signature, err := hex.DecodeString(c.GetHeader(HeaderSignature))
+	if timestamp == "" || nonce == "" || len(nonce) > maxNonceLength || err != nil {
+		return false
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	maxSkew := a.config.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = 300
+	}
+	if math.Abs(float64(time.Now().Unix()-ts)) > float64(maxSkew) {
+		return false
+	}
+
+	var body []byte
+	if c.Request.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBodySize+1))
+		if err != nil || len(body) > maxSignedBodySize {
+			return false
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := Sign(a.config.Secret, c.Request.Method, c.Request.URL.RequestURI(), timestamp, nonce, body)
+	if !hmac.Equal(signature, expected) {
+		return false
+	}
+
+	// 签名有效后才记录 nonce，避免未认证的请求占满缓存
+	expires := time.Unix(ts, 0).Add(time.Duration(maxSkew) * time.Second)
+	if !a.nonces.use(nonce, expires, time.Now()) {
+		log.Printf("[FeasOJ] Rejected replayed request %s %s", c.Request.Method, c.Request.URL.Path)
+		return false
+	}
+	return true
+}
+
+// Sign 计算请求签名: HMAC-SHA256(secret, method\nrequestURI\ntimestamp\nnonce\nhex(sha256(body)))
+func Sign(secret, method, requestURI, timestamp, nonce string, body []byte) []byte {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(method + "\n" + requestURI + "\n" + timestamp + "\n" + nonce + "\n" + hex.EncodeToString(bodyHash[:])))
+	return mac.Sum(nil)
+}
+
+// nonceCache 记录签名时间戳仍有效的请求 nonce，仅在当前实例内存中生效
+type nonceCache struct {
+	mutex     sync.Mutex
+	seen      map[string]time.Time // nonce -> 时间戳失效的时间
+	lastPrune time.Time
+}
+
+func newNonceCache() *nonceCache {
+	return &nonceCache{seen: make(map[string]time.Time)}
+}
+
+// use 记录 nonce，nonce 在失效前已被使用时返回 false
+// 时间戳失效后请求本身会被拒绝，因此过期的 nonce 可以安全删除
+func (n *nonceCache) use(nonce string, expires, now time.Time) bool {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	if now.Sub(n.lastPrune) > time.Minute {
+		for seen, exp := range n.seen {
+			if !exp.After(now) {
+				delete(n.seen, seen)
+			}
+		}
+		n.lastPrune = now
+	}
+
+	if exp, ok := n.seen[nonce]; ok && exp.After(now) {
+		return false
+	}
+	n.seen[nonce] = expires
+	return true
+}
@@ -0,0 +1,118 @@
+package middlewares
+
+import (
+	"JudgeCore/internal/config"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newAuthRouter(authConfig config.Auth) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	auth := NewAuthenticator(authConfig)
+	router.GET("/health", func(c *gin.Context) { c.String(http.StatusOK, "OK") })
+	router.POST("/judge", auth.Require(ScopeJudge), func(c *gin.Context) { c.String(http.StatusOK, "OK") })
+	return router
+}
+
+func TestAuthHMAC(t *testing.T) {
+	router := newAuthRouter(config.Auth{Mode: AuthModeHMAC, Secret: "secret", MaxSkew: 60})
+
+	// 健康检查无需凭据
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/health", nil))
+	if recorder.Code != http.StatusOK {
+		t.Error(recorder.Code)
+	}
+
+	// 未签名请求被拒绝
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/judge", strings.NewReader("code")))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Error(recorder.Code)
+	}
+
+	// 正确签名的请求通过
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	if code := sendSigned(router, timestamp, "n1", "code", "code"); code != http.StatusOK {
+		t.Error(code)
+	}
+
+	// 重放的请求被拒绝
+	if code := sendSigned(router, timestamp, "n1", "code", "code"); code != http.StatusUnauthorized {
+		t.Error(code)
+	}
+
+	// 请求体被篡改
+	if code := sendSigned(router, timestamp, "n2", "code", "evil"); code != http.StatusUnauthorized {
+		t.Error(code)
+	}
+
+	// 篡改签名的请求不占用 nonce
+	if code := sendSigned(router, timestamp, "n2", "code", "code"); code != http.StatusOK {
+		t.Error(code)
+	}
+
+	// 时间戳过期
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	if code := sendSigned(router, expired, "n3", "code", "code"); code != http.StatusUnauthorized {
+		t.Error(code)
+	}
+}
+
+// sendSigned 发送对 signedBody 签名、实际请求体为 body 的请求，返回响应状态码
+func sendSigned(router *gin.Engine, timestamp, nonce, signedBody, body string) int {
+	req := httptest.NewRequest("POST", "/judge", strings.NewReader(body))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderNonce, nonce)
+	req.Header.Set(HeaderSignature, hex.EncodeToString(Sign("secret", "POST", "/judge", timestamp, nonce, []byte(signedBody))))
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	return recorder.Code
+}
+
+func TestAuthToken(t *testing.T) {
+	router := newAuthRouter(config.Auth{
+		Mode: AuthModeToken,
+		Tokens: []config.AuthToken{
+			{Token: "judge-token", Scopes: []string{ScopeJudge}},
+			{Token: "run-token", Scopes: []string{ScopeRun}},
+		},
+	})
+
+	cases := map[string]int{
+		"":                   http.StatusUnauthorized,
+		"Bearer wrong":       http.StatusUnauthorized,
+		"Bearer run-token":   http.StatusForbidden,
+		"Bearer judge-token": http.StatusOK,
+		"Basic judge-token":  http.StatusUnauthorized,
+	}
+	for header, want := range cases {
+		req := httptest.NewRequest("POST", "/judge", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, req)
+		if recorder.Code != want {
+			t.Error(header, recorder.Code)
+		}
+	}
+}
+
+func TestAuthUnconfigured(t *testing.T) {
+	router := newAuthRouter(config.Auth{})
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("POST", "/judge", nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Error(recorder.Code)
+	}
+}
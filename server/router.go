@@ -1,6 +1,7 @@
 package server
 
 import (
+	"JudgeCore/internal/config"
 	"JudgeCore/internal/judge"
 	"JudgeCore/server/handler"
 	"JudgeCore/server/middlewares"
@@ -9,15 +10,35 @@ import (
 	"gorm.io/gorm"
 )
 
-func LoadRouter(r *gin.Engine, db *gorm.DB, pool *judge.JudgePool, codeDir string) {
+func LoadRouter(r *gin.Engine, serverConfig config.Server, authConfig config.Auth, rmqConfig config.RabbitMQ, db *gorm.DB, pool *judge.JudgePool, codeDir string) {
 	r.Use(middlewares.Logger())
 
 	// Create a handler instance with its dependencies
-	h := handler.NewHandler(codeDir)
+	h := handler.NewHandler(serverConfig, rmqConfig, db, pool, codeDir)
+	auth := middlewares.NewAuthenticator(authConfig)
 
 	apiV1 := r.Group("/api/v1/judgecore")
 	{
 		apiV1.GET("/health", h.Health)
-		apiV1.POST("/judge", h.Judge)
+		apiV1.POST("/judge", auth.Require(middlewares.ScopeJudge), h.Judge)
+		apiV1.POST("/judge/sync", auth.Require(middlewares.ScopeJudge), h.JudgeSync)
+		apiV1.POST("/run", auth.Require(middlewares.ScopeRun), h.Run)
+
+		rejudge := apiV1.Group("/rejudge", auth.Require(middlewares.ScopeRejudge))
+		{
+			rejudge.POST("/submission/:id", h.RejudgeSubmission)
+			rejudge.POST("/problem/:id", h.RejudgeProblem)
+			rejudge.POST("/contest/:id", h.RejudgeContest)
+			rejudge.GET("", h.RejudgeJobs)
+			rejudge.GET("/:job_id", h.RejudgeJob)
+		}
+
+		settings := apiV1.Group("/settings", auth.Require(middlewares.ScopeSettings))
+		{
+			settings.GET("/problem/:id", h.ProblemSetting)
+			settings.PUT("/problem/:id", h.UpdateProblemSetting)
+			settings.GET("/contest/:id", h.ContestSetting)
+			settings.PUT("/contest/:id", h.UpdateContestSetting)
+		}
 	}
 }
\ No newline at end of file